@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// adminMiddleware guards the admin endpoints. Requests must carry the
+// configured admin token as `Authorization: Bearer <token>`. When no token has
+// been configured, the admin endpoints are disabled altogether
+func adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminToken == "" {
+			writeJSONError(w, http.StatusForbidden, "admin endpoints are disabled")
+			return
+		}
+
+		if !hasBearerToken(r, config.AdminToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// replaceDescriptionHandler cleans up placeholder descriptions (such as "TBD"
+// or "Lorem ipsum") left by imports. It takes
+// `{"placeholder": "TBD", "replacement": ""}`, sets the description of every
+// bird that is exactly the placeholder to the replacement, and responds with
+// the number of birds changed, as `{"updated": 3}`
+func (s *Server) replaceDescriptionHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Placeholder string `json:"placeholder"`
+		Replacement string `json:"replacement"`
+	}{}
+	if err := decodeJSON(r.Body, &body); bodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the body must be a JSON object with a placeholder: "+err.Error())
+		return
+	}
+	if body.Placeholder == "" {
+		writeJSONError(w, http.StatusBadRequest, "the placeholder must not be empty")
+		return
+	}
+
+	updated, err := s.store.ReplaceDescription(r.Context(), body.Placeholder, body.Replacement)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"updated": updated})
+}
+
+// deleteBirdsMatchingHandler deletes every bird matching the filter of the
+// query parameters, such as `?species=eagle`, and responds with the number of
+// birds deleted, as `{"deleted": 3}`. As there is no undo, the request must
+// also confirm the deletion with `confirm=true`, and a filter is required
+func (s *Server) deleteBirdsMatchingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		writeJSONError(w, http.StatusBadRequest, "the deletion must be confirmed with confirm=true")
+		return
+	}
+	opts := queryOptionsFromURL(r.URL.Query())
+	if opts.isEmpty() {
+		writeJSONError(w, http.StatusBadRequest, "a filter, such as species, is required")
+		return
+	}
+
+	deleted, err := s.store.DeleteBirdsMatching(r.Context(), opts)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"deleted": deleted})
+}
+
+// schemaVersionHandler responds with the version of the database schema, and
+// the one this build expects, as `{"version": 1, "expected": 1}`
+func (s *Server) schemaVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := s.store.SchemaVersion(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"version": version, "expected": schemaVersion})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplaceDescriptionHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("ReplaceDescription", "TBD", "").Return(3, nil).Once()
+
+	hf := http.HandlerFunc(srv.replaceDescriptionHandler)
+
+	tests := []struct {
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{`{"placeholder":"TBD","replacement":""}`, http.StatusOK, `{"updated":3}`},
+		{`{"replacement":"something"}`, http.StatusBadRequest, ""},
+		{`not json`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("POST", "/admin/descriptions/replace", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.body, status, tt.expectedStatus)
+		}
+		if tt.expectedBody != "" && recorder.Body.String() != tt.expectedBody {
+			t.Errorf("%s: handler returned unexpected body: got %v want %v",
+				tt.body, recorder.Body.String(), tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestDeleteBirdsMatchingHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteBirdsMatching", QueryOptions{Species: "dodo"}).Return(3, nil).Once()
+
+	hf := http.HandlerFunc(srv.deleteBirdsMatchingHandler)
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"species=dodo&confirm=true", http.StatusOK, `{"deleted":3}`},
+		{"species=dodo", http.StatusBadRequest, ""},
+		{"confirm=true", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("DELETE", "/admin/birds?"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.query, status, tt.expectedStatus)
+		}
+		if tt.expectedBody != "" && recorder.Body.String() != tt.expectedBody {
+			t.Errorf("%s: handler returned unexpected body: got %v want %v",
+				tt.query, recorder.Body.String(), tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestSchemaVersionHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("SchemaVersion").Return(schemaVersion+1, nil).Once()
+
+	req, err := http.NewRequest("GET", "/admin/schema-version", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.schemaVersionHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	expected := fmt.Sprintf(`{"expected":%d,"version":%d}`, schemaVersion, schemaVersion+1)
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", recorder.Body.String(), expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// hasBearerToken tells whether `r` carries `token` as
+// `Authorization: Bearer <token>`. The scheme is case-insensitive, but has to
+// be there. The tokens are compared in constant time, so that the time taken
+// doesn't tell how much of a guess was right
+func hasBearerToken(r *http.Request, token string) bool {
+	scheme, given, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) == 1
+}
+
+// isWriteRequest matches the requests that change birds, which are the ones
+// guarded by `authMiddleware`
+func isWriteRequest(r *http.Request, _ *mux.RouteMatch) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// authMiddleware guards the endpoints that create, change or delete birds.
+// Requests must carry the configured API key as `Authorization: Bearer <key>`,
+// or they get 401 Unauthorized. When no key has been configured, the requests
+// are let through, as before there were keys, and `main` warns about it on
+// startup
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.APIKey != "" && !hasBearerToken(r, config.APIKey) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="birds"`)
+			writeJSONError(w, http.StatusUnauthorized, "a valid API key is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
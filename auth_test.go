@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.APIKey = "bird-secret"
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	mockStore.On("CreateBird", &Bird{Species: "eagle"}).Return(nil).Twice()
+	router := newRouter(srv)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		authorization  string
+		expectedStatus int
+	}{
+		// Reading stays public...
+		{"get without key", "GET", "/bird", "", http.StatusOK},
+		// ...but writing needs the key
+		{"post without key", "POST", "/bird", "", http.StatusUnauthorized},
+		{"post with wrong key", "POST", "/bird", "Bearer not-the-secret", http.StatusUnauthorized},
+		{"post without scheme", "POST", "/bird", "bird-secret", http.StatusUnauthorized},
+		{"post with another scheme", "POST", "/bird", "Basic bird-secret", http.StatusUnauthorized},
+		{"delete without key", "DELETE", "/bird/1", "", http.StatusUnauthorized},
+		{"patch without key", "PATCH", "/bird/1", "", http.StatusUnauthorized},
+		{"post with key", "POST", "/bird", "Bearer bird-secret", http.StatusCreated},
+		// The scheme is case-insensitive
+		{"post with lowercase scheme", "POST", "/bird", "bearer bird-secret", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"species":"eagle"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, status, tt.expectedStatus)
+		}
+		if tt.expectedStatus == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", tt.name)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestAuthMiddlewareWithoutKey(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.APIKey = ""
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteBird", 1).Return(nil).Once()
+
+	// Without a configured key, writing is open, as it was before keys
+	req := httptest.NewRequest("DELETE", "/bird/1", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(srv).ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusNoContent)
+	}
+
+	mockStore.AssertExpectations(t)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// backupHandler responds with a ZIP archive holding every bird, each as a JSON
+// file named after its ID. The archive is written as the birds are read from
+// the database, so that the backup never has to fit in memory
+func (s *Server) backupHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="birds-backup.zip"`)
+
+	archive := zip.NewWriter(w)
+	err := s.store.EachBird(r.Context(), func(bird *Bird) error {
+		f, err := archive.Create(strconv.Itoa(bird.ID) + ".json")
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(f).Encode(bird)
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	// Once the archive has started streaming, the status can't be changed
+	// anymore. The client is left with a truncated archive, which it will fail
+	// to open
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+	}
+}
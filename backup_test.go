@@ -0,0 +1,61 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBackupHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("EachBird").Return([]*Bird{
+		{ID: 1, Species: "sparrow", Description: "A small harmless bird"},
+		{ID: 7, Species: "eagle", Description: "A bird of prey"},
+	}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/backup.zip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.backupHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/zip" {
+		t.Errorf("handler returned wrong content type: got %q want %q", contentType, "application/zip")
+	}
+
+	body := recorder.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archive.File) != 2 {
+		t.Fatalf("archive should have 2 entries, got %d", len(archive.File))
+	}
+	if name := archive.File[1].Name; name != "7.json" {
+		t.Errorf("entry should be named after the bird ID, got %q", name)
+	}
+
+	f, err := archive.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bird := Bird{}
+	if err := json.NewDecoder(f).Decode(&bird); err != nil {
+		t.Fatal(err)
+	}
+	if bird.ID != 7 || bird.Species != "eagle" || bird.Description != "A bird of prey" {
+		t.Errorf("entry has the wrong bird: %+v", bird)
+	}
+
+	mockStore.AssertExpectations(t)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+// The benchmarks give us a baseline for the time and allocations each
+// operation takes, so that changes can be compared against it with
+// `go test -run=XXX -bench=. -benchmem`
+
+// openBenchStore connects to the test database, and skips the benchmark if it
+// isn't available
+func openBenchStore(b *testing.B) *dbStore {
+	if testConnString == "" {
+		b.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", testConnString)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		b.Skipf("test database unavailable: %v", err)
+	}
+	if _, err := db.Exec(schemaSQL()); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM birds"); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	return &dbStore{db: db}
+}
+
+func BenchmarkCreateBird(b *testing.B) {
+	ctx := context.Background()
+	s := openBenchStore(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.CreateBird(ctx, &Bird{Species: "sparrow", Description: "A small harmless bird"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetBirds(b *testing.B) {
+	ctx := context.Background()
+	s := openBenchStore(b)
+	for i := 0; i < 100; i++ {
+		if err := s.CreateBird(ctx, &Bird{Species: fmt.Sprintf("bird %d", i), Description: "description"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetBirds(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteBirds measures the JSON marshaling path that `getBirdHandler`
+// uses to respond with a list of birds
+func BenchmarkWriteBirds(b *testing.B) {
+	birds := make([]*Bird, 100)
+	for i := range birds {
+		birds[i] = &Bird{Species: fmt.Sprintf("bird %d", i), Description: "A small harmless bird"}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		writeBirds(httptest.NewRecorder(), birds)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// bodyLimitMiddleware cuts the request body off after `config.MaxBodyBytes`,
+// so that a huge payload can't exhaust our memory. Reading past the limit
+// fails with an error that handlers answer with `writeBodyTooLarge`
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, config.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyTooLarge tells if reading the request body failed because it is over
+// the limit set by `bodyLimitMiddleware`
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// writeBodyTooLarge responds with 413 Request Entity Too Large
+func writeBodyTooLarge(w http.ResponseWriter) {
+	writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body can be at most %d bytes", config.MaxBodyBytes))
+}
+
+// bodyTimeoutMiddleware reads the whole request body before the handler runs,
+// and answers 408 Request Timeout when it doesn't arrive within
+// `config.BodyReadTimeout`, so that a client trickling its body can't hold on
+// to the handler. The connection is closed with the response, which also
+// stops the read in the background. Nothing is done when the timeout is 0.
+// The body is held in memory, so this must come after `bodyLimitMiddleware`
+func bodyTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.BodyReadTimeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), config.BodyReadTimeout)
+		defer cancel()
+
+		type result struct {
+			body []byte
+			err  error
+		}
+		read := make(chan result, 1)
+		go func(body io.Reader) {
+			b, err := io.ReadAll(body)
+			read <- result{b, err}
+		}(r.Body)
+
+		select {
+		case <-ctx.Done():
+			w.Header().Set("Connection", "close")
+			writeJSONError(w, http.StatusRequestTimeout, "the request body took too long to arrive")
+		case res := <-read:
+			if bodyTooLarge(res.err) {
+				writeBodyTooLarge(w)
+				return
+			}
+			if res.err != nil {
+				writeJSONError(w, http.StatusBadRequest, "the request body could not be read")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(res.body))
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// slowReader gives out its data one byte at a time, waiting `delay` before
+// each one, like a client on a very slow connection
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	if s.data == "" {
+		return 0, io.EOF
+	}
+	n := copy(p[:1], s.data)
+	s.data = s.data[n:]
+	return n, nil
+}
+
+func TestBodyTimeoutMiddleware(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.BodyReadTimeout = 50 * time.Millisecond
+
+	mockStore := InitMockStore()
+	mockStore.On("CreateBird", mock.AnythingOfType("*main.Bird")).Return(nil).Once()
+	router := newRouter(newServer(mockStore))
+
+	tests := []struct {
+		name           string
+		delay          time.Duration
+		expectedStatus int
+	}{
+		{"slow body", 20 * time.Millisecond, http.StatusRequestTimeout},
+		{"fast body", 0, http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		body := &slowReader{data: "species=eagle&description=A+bird+of+prey", delay: tt.delay}
+		req, err := http.NewRequest("POST", "/bird", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		if tt.expectedStatus == http.StatusRequestTimeout && !strings.Contains(recorder.Body.String(), "too long") {
+			t.Errorf("%s: handler returned unexpected body: %q", tt.name, recorder.Body.String())
+		}
+	}
+
+	// Only the body that arrived in time was used
+	mockStore.AssertExpectations(t)
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.MaxBodyBytes = 64
+
+	mockStore := InitMockStore()
+	mockStore.On("CreateBird", mock.AnythingOfType("*main.Bird")).Return(nil)
+	router := newRouter(newServer(mockStore))
+
+	// The bodies are padded up to `size` bytes with the description
+	jsonBody := func(size int) string {
+		body := `{"species":"eagle","description":""}`
+		return body[:len(body)-2] + strings.Repeat("a", size-len(body)) + `"}`
+	}
+	formBody := func(size int) string {
+		body := "species=eagle&description="
+		return body + strings.Repeat("a", size-len(body))
+	}
+
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		timeout        time.Duration
+		expectedStatus int
+	}{
+		{"JSON under the limit", "application/json", jsonBody(64), 0, http.StatusFound},
+		{"JSON over the limit", "application/json", jsonBody(65), 0, http.StatusRequestEntityTooLarge},
+		{"form under the limit", "application/x-www-form-urlencoded", formBody(64), 0, http.StatusFound},
+		{"form over the limit", "application/x-www-form-urlencoded", formBody(65), 0, http.StatusRequestEntityTooLarge},
+		// The body is then read in full by the timeout middleware
+		{"over the limit, with a timeout", "application/json", jsonBody(65), time.Second, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		config.BodyReadTimeout = tt.timeout
+		req, err := http.NewRequest("POST", "/bird", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", tt.contentType)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v (%s)",
+				tt.name, status, tt.expectedStatus, recorder.Body.String())
+		}
+	}
+}
+
+func TestBodyLimitOtherRoutes(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.MaxBodyBytes = 64
+	config.AdminToken = "admin-secret"
+
+	// None of the oversized bodies should reach the store
+	router := newRouter(newServer(InitMockStore()))
+	body := `{"species":"eagle","description":"` + strings.Repeat("a", 64) + `"}`
+
+	for _, route := range []struct{ method, path string }{
+		{"PUT", "/bird/1"},
+		{"PATCH", "/bird/1"},
+		{"POST", "/birds"},
+		{"POST", "/admin/descriptions/replace"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s %s: handler returned wrong status code: got %v want %v",
+				route.method, route.path, status, http.StatusRequestEntityTooLarge)
+		}
+	}
+}
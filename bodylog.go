@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// sensitiveFields matches the JSON fields whose values are never logged, as in
+// `"password": "hunter2"`. It works on truncated bodies too, which can't be
+// parsed as JSON anymore
+var sensitiveFields = regexp.MustCompile(`(?i)("(?:password|secret|token|api_key|authorization)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// redactBody hides the values of the sensitive fields of `body`, and cuts it
+// down to `max` bytes
+func redactBody(body []byte, max int) string {
+	truncated := len(body) > max
+	if truncated {
+		body = body[:max]
+	}
+	redacted := sensitiveFields.ReplaceAllString(string(body), `$1"REDACTED"`)
+	if truncated {
+		redacted += "...(truncated)"
+	}
+	return redacted
+}
+
+// redactedHeader is `header`, with the values of the `sensitiveHeaders`
+// hidden, in the form of a log line
+func redactedHeader(header http.Header) string {
+	header = header.Clone()
+	for _, name := range sensitiveHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "REDACTED")
+		}
+	}
+	var b strings.Builder
+	header.Write(&b)
+	return strings.ReplaceAll(strings.TrimSpace(b.String()), "\r\n", "; ")
+}
+
+// bodyRecorder keeps the first bytes of the response body written through it,
+// one more than `max`, to tell if the body was cut down
+type bodyRecorder struct {
+	http.ResponseWriter
+	max  int
+	body bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(p []byte) (int, error) {
+	if room := rec.max + 1 - rec.body.Len(); room > 0 {
+		rec.body.Write(p[:min(room, len(p))])
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap gives `http.ResponseController` access to the underlying writer
+func (rec *bodyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// bodyLogMiddleware logs the request and response bodies of the `routes`, as
+// in `method=POST path=/bird request_body="..." response_body="..."`, for
+// debugging. Each body is cut down to `max` bytes, and the values of
+// sensitive fields and headers are hidden. The request body is put back
+// together, so that the handler can still read all of it
+func bodyLogMiddleware(routes []string, max int, next http.Handler) http.Handler {
+	logged := map[string]bool{}
+	for _, route := range routes {
+		logged[route] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !logged[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// One byte more than is logged tells if the body was cut down
+		var requestBody []byte
+		if r.Body != nil {
+			var err error
+			requestBody, err = io.ReadAll(io.LimitReader(r.Body, int64(max)+1))
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "could not read the request body")
+				return
+			}
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+		}
+
+		rec := &bodyRecorder{ResponseWriter: w, max: max}
+		next.ServeHTTP(rec, r)
+		log.Printf("method=%s path=%s headers=%q request_body=%q response_body=%q",
+			r.Method, logValue(r.URL.Path), redactedHeader(r.Header), redactBody(requestBody, max), redactBody(rec.body.Bytes(), max))
+	})
+}
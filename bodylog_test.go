@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodyLogMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	var received string
+	hf := bodyLogMiddleware([]string{"/bird"}, 64, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Write([]byte(`{"id":1,"species":"eagle"}`))
+	}))
+
+	body := `{"species":"eagle","token":"s3cret","description":"` + strings.Repeat("a", 100) + `"}`
+	req := httptest.NewRequest("POST", "/bird", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+
+	// The handler still gets the whole body, and the client the whole response
+	if received != body {
+		t.Errorf("the handler should get the whole body, got %q", received)
+	}
+	if recorder.Body.String() != `{"id":1,"species":"eagle"}` {
+		t.Errorf("the client should get the whole response, got %q", recorder.Body.String())
+	}
+
+	logged := logs.String()
+	for _, expected := range []string{
+		`method=POST path=/bird`,
+		`request_body="{\"species\":\"eagle\",\"token\":\"REDACTED\",\"description\":\"` + strings.Repeat("a", 13) + `...(truncated)"`,
+		`response_body="{\"id\":1,\"species\":\"eagle\"}"`,
+		`Content-Type: application/json`,
+	} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("the log should contain %s, got %q", expected, logged)
+		}
+	}
+	for _, secret := range []string{"s3cret", "admin-secret", strings.Repeat("a", 14)} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("the log should not contain %q, got %q", secret, logged)
+		}
+	}
+
+	// Other routes aren't logged
+	logs.Reset()
+	req = httptest.NewRequest("POST", "/birds", strings.NewReader(body))
+	hf.ServeHTTP(httptest.NewRecorder(), req)
+	if logs.Len() != 0 {
+		t.Errorf("only the chosen routes should be logged, got %q", logs.String())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cachingStore keeps the list of birds of `GetBirds` for `ttl`, in front of a
+// store that is expensive to read, such as the database. Every other method
+// goes through to the wrapped store, and the ones that change birds throw the
+// list away, so that clients see their own writes
+type cachingStore struct {
+	Store
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	birds   []*Bird
+	expires time.Time
+	// generation is bumped by every write, so that a list read while a write
+	// was going on isn't kept, as it may be missing the write
+	generation int
+}
+
+func newCachingStore(store Store, ttl time.Duration) *cachingStore {
+	return &cachingStore{Store: store, ttl: ttl, now: time.Now}
+}
+
+// GetBirds returns the cached list while it is fresh, and reads it again
+// from the wrapped store otherwise. The birds are copies, which callers can
+// change without touching the cache. Errors aren't cached
+func (c *cachingStore) GetBirds(ctx context.Context) ([]*Bird, error) {
+	c.mu.Lock()
+	if c.birds != nil && c.now().Before(c.expires) {
+		birds := copyBirds(c.birds)
+		c.mu.Unlock()
+		return birds, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	// The store is read without the lock, so that writes don't wait for it
+	birds, err := c.Store.GetBirds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.birds, c.expires = copyBirds(birds), c.now().Add(c.ttl)
+	}
+	return birds, nil
+}
+
+// invalidate throws the cached list away
+func (c *cachingStore) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.birds = nil
+	c.generation++
+}
+
+// copyBirds copies the birds of a list, and not only the pointers to them
+func copyBirds(birds []*Bird) []*Bird {
+	copied := make([]*Bird, len(birds))
+	for i, bird := range birds {
+		b := *bird
+		copied[i] = &b
+	}
+	return copied
+}
+
+func (c *cachingStore) CreateBird(ctx context.Context, bird *Bird) error {
+	defer c.invalidate()
+	return c.Store.CreateBird(ctx, bird)
+}
+
+func (c *cachingStore) CreateBirds(ctx context.Context, birds []*Bird) error {
+	defer c.invalidate()
+	return c.Store.CreateBirds(ctx, birds)
+}
+
+func (c *cachingStore) ImportBirds(ctx context.Context, birds []*Bird, strategy ConflictStrategy) ([]ImportOutcome, error) {
+	defer c.invalidate()
+	return c.Store.ImportBirds(ctx, birds, strategy)
+}
+
+func (c *cachingStore) UpdateColumns(ctx context.Context, id int, fields map[string]any) error {
+	defer c.invalidate()
+	return c.Store.UpdateColumns(ctx, id, fields)
+}
+
+func (c *cachingStore) UpdateBird(ctx context.Context, id int, bird *Bird) error {
+	defer c.invalidate()
+	return c.Store.UpdateBird(ctx, id, bird)
+}
+
+func (c *cachingStore) PatchBird(ctx context.Context, id int, species, description *string) error {
+	defer c.invalidate()
+	return c.Store.PatchBird(ctx, id, species, description)
+}
+
+func (c *cachingStore) DeleteBird(ctx context.Context, id int) error {
+	defer c.invalidate()
+	return c.Store.DeleteBird(ctx, id)
+}
+
+func (c *cachingStore) DeleteAllBirds(ctx context.Context) error {
+	defer c.invalidate()
+	return c.Store.DeleteAllBirds(ctx)
+}
+
+func (c *cachingStore) DeleteBirdsMatching(ctx context.Context, opts QueryOptions) (int, error) {
+	defer c.invalidate()
+	return c.Store.DeleteBirdsMatching(ctx, opts)
+}
+
+func (c *cachingStore) ReplaceDescription(ctx context.Context, placeholder, replacement string) (int, error) {
+	defer c.invalidate()
+	return c.Store.ReplaceDescription(ctx, placeholder, replacement)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	mockStore := InitMockStore()
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Once()
+	mockStore.On("CreateBird", &Bird{Species: "eagle"}).Return(nil).Once()
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}, {ID: 2, Species: "eagle"}}, nil).Once()
+	now := time.Now()
+	store := newCachingStore(mockStore, time.Minute)
+	store.now = func() time.Time { return now }
+
+	birds, err := store.GetBirds(ctx)
+	if err != nil || len(birds) != 1 {
+		t.Fatalf("expected the birds of the store, got %v (%v)", birds, err)
+	}
+	// Changing the birds handed out doesn't change the cache
+	birds[0].Species = "changed"
+
+	// The second list within the TTL comes from the cache, which the mock
+	// tells by failing on a third call to GetBirds
+	birds, err = store.GetBirds(ctx)
+	if err != nil || len(birds) != 1 || birds[0].Species != "sparrow" {
+		t.Fatalf("expected the cached birds, got %v (%v)", birds, err)
+	}
+	mockStore.AssertNumberOfCalls(t, "GetBirds", 1)
+
+	// A new bird throws the cache away
+	if err := store.CreateBird(ctx, &Bird{Species: "eagle"}); err != nil {
+		t.Fatal(err)
+	}
+	birds, err = store.GetBirds(ctx)
+	if err != nil || len(birds) != 2 {
+		t.Fatalf("expected the birds with the new one, got %v (%v)", birds, err)
+	}
+	mockStore.AssertNumberOfCalls(t, "GetBirds", 2)
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCachingStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	mockStore := InitMockStore()
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Twice()
+	now := time.Now()
+	store := newCachingStore(mockStore, time.Minute)
+	store.now = func() time.Time { return now }
+
+	store.GetBirds(ctx)
+	now = now.Add(time.Minute)
+	store.GetBirds(ctx)
+	mockStore.AssertNumberOfCalls(t, "GetBirds", 2)
+}
+
+func TestCachingStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("connection refused")
+	mockStore := InitMockStore()
+	mockStore.On("GetBirds").Return(nil, failure).Once()
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Once()
+	store := newCachingStore(mockStore, time.Minute)
+
+	// A failure isn't cached, so the next list is tried again
+	if _, err := store.GetBirds(ctx); err != failure {
+		t.Errorf("expected the error of the store, got %v", err)
+	}
+	if birds, err := store.GetBirds(ctx); err != nil || len(birds) != 1 {
+		t.Errorf("expected the birds of the store, got %v (%v)", birds, err)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+// TestCachingStoreConcurrentAccess is meant to be run with `-race`
+func TestCachingStoreConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	store := newCachingStore(newMemStore(), time.Minute)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				store.CreateBird(ctx, &Bird{Species: fmt.Sprintf("sparrow %d-%d", w, i)})
+				store.GetBirds(ctx)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Once the writes are done, the list has every bird
+	if birds, _ := store.GetBirds(ctx); len(birds) != 8*20 {
+		t.Errorf("expected %d birds, got %d", 8*20, len(birds))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// cacheControlMiddleware returns a `mux` middleware, which sets the
+// `Cache-Control` header of the responses of the routes in `headers`, keyed by
+// method and path template (such as "GET /bird/{id}"). The header is set
+// before the handler runs, so handlers can still change it
+func cacheControlMiddleware(headers map[string]string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					if header, ok := headers[r.Method+" "+template]; ok {
+						w.Header().Set("Cache-Control", header)
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
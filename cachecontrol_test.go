@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCacheControlMiddleware(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	mockStore.On("CreateBird", mock.AnythingOfType("*main.Bird")).Return(nil)
+	mockStore.On("GetBirdByID", 1).Return(&Bird{ID: 1, Species: "eagle"}, nil)
+	mockStore.On("IncrementViews", 1).Return(nil)
+
+	r := newRouter(srv)
+	r.Use(cacheControlMiddleware(map[string]string{
+		"GET /bird":  "public, max-age=60",
+		"POST /bird": "no-store",
+	}))
+
+	form := url.Values{"species": {"eagle"}}
+	tests := []struct {
+		method               string
+		path                 string
+		expectedCacheControl string
+	}{
+		{"GET", "/bird", "public, max-age=60"},
+		{"POST", "/bird", "no-store"},
+		// Routes that aren't configured don't get the header
+		{"GET", "/bird/1", ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		if header := recorder.Header().Get("Cache-Control"); header != tt.expectedCacheControl {
+			t.Errorf("%s %s: wrong Cache-Control: got %q want %q", tt.method, tt.path, header, tt.expectedCacheControl)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// sensitiveHeaders are never written to the capture file, since anyone reading
+// it could use them to impersonate the client
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// maxCapturedBody is the most of each request body that is written to the
+// capture file
+const maxCapturedBody = 64 << 10
+
+// capturedRequest is one line of the capture file, with everything needed to
+// replay the request later
+type capturedRequest struct {
+	Time       time.Time   `json:"time"`
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	RemoteAddr string      `json:"remote_addr"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// requestCapture is a debugging aid, which records every request it sees to a
+// file, as one JSON object per line. Once the file grows past `maxBytes` it is
+// rotated to "<path>.1", replacing the previous one, and a new file is started
+type requestCapture struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+func newRequestCapture(path string, maxBytes int64) (*requestCapture, error) {
+	c := &requestCapture{path: path, maxBytes: maxBytes}
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *requestCapture) open() error {
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	c.file, c.size = file, info.Size()
+	return nil
+}
+
+// middleware records each request before handing it on. The body is put back
+// together, so that the handler can still read all of it
+func (c *requestCapture) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxCapturedBody))
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "could not read the request body")
+				return
+			}
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		header := r.Header.Clone()
+		for _, name := range sensitiveHeaders {
+			if header.Get(name) != "" {
+				header.Set(name, "REDACTED")
+			}
+		}
+
+		err := c.write(capturedRequest{
+			Time:       time.Now(),
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			RemoteAddr: r.RemoteAddr,
+			Header:     header,
+			Body:       string(body),
+		})
+		if err != nil {
+			// Failing to capture a request shouldn't fail the request itself
+			fmt.Println(fmt.Errorf("Error: capturing request: %v", err))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *requestCapture) write(record capturedRequest) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size > 0 && c.size+int64(len(line)) > c.maxBytes {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := c.file.Write(line)
+	c.size += int64(n)
+	return err
+}
+
+func (c *requestCapture) rotate() error {
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(c.path, c.path+".1"); err != nil {
+		return err
+	}
+	return c.open()
+}
+
+func (c *requestCapture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
+
+// readCloser reads from one reader, and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.log")
+	capture, err := newRequestCapture(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.Close()
+
+	// The handler behind the middleware should still see the whole body
+	var handlerBody string
+	hf := capture.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		handlerBody = string(b)
+	}))
+
+	req, err := http.NewRequest("POST", "/bird?debug=1", strings.NewReader("species=eagle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hf.ServeHTTP(httptest.NewRecorder(), req)
+
+	if handlerBody != "species=eagle" {
+		t.Errorf("handler received unexpected body: got %q", handlerBody)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("no request was captured")
+	}
+	record := capturedRequest{}
+	if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if record.Method != "POST" || record.URL != "/bird?debug=1" || record.Body != "species=eagle" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if record.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("expected the Content-Type header to be captured, got %v", record.Header)
+	}
+	if auth := record.Header.Get("Authorization"); auth != "REDACTED" {
+		t.Errorf("Authorization header should be redacted, got %q", auth)
+	}
+}
+
+func TestRequestCaptureRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.log")
+	// A tiny limit, so that every record starts a new file
+	capture, err := newRequestCapture(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer capture.Close()
+
+	hf := capture.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, url := range []string{"/first", "/second"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hf.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// The first request should have been rotated out, and the second one
+	// should be in the current file
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(rotated), `"/first"`) || !strings.Contains(string(current), `"/second"`) {
+		t.Errorf("unexpected rotation: rotated %q, current %q", rotated, current)
+	}
+}
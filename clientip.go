@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client that made the request.
+//
+// When the request comes straight from the client, that is the address of the
+// peer (`RemoteAddr`). When it comes from one of the configured trusted
+// proxies, the client is the last address in `X-Forwarded-For` that wasn't
+// added by a trusted proxy. The header is ignored for any other peer, since
+// clients can put anything they like in it
+func ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// `RemoteAddr` has no port when it wasn't set by the http server
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	// Each proxy appends the address it received the request from, so we
+	// walk the list backwards, until we find an address we can't vouch for
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+		peer = addr
+		if !isTrustedProxy(addr) {
+			break
+		}
+	}
+	return peer
+}
+
+// isTrustedProxy reports whether `addr` is in one of the trusted proxy networks
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range config.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
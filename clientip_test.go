@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseCIDRs("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old Config) { config = old }(config)
+	config.TrustedProxies = trusted
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"direct client", "203.0.113.7:5123", "", "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:5123", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:80", "198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:80", "198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"spoofed entry before the client", "10.1.2.3:80", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"trusted proxy without header", "192.168.1.1:80", "", "192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+
+		if ip := ClientIP(req); ip != tt.expectedIP {
+			t.Errorf("%s: got %s want %s", tt.name, ip, tt.expectedIP)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigInvalidTrustedProxies(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "TRUSTED_PROXIES" {
+			return "10.0.0.0/8,not-an-ip"
+		}
+		return ""
+	}
+	if _, err := loadConfig(getenv); err == nil {
+		t.Error("expected an error for an invalid trusted proxy")
+	}
+}
+
+func TestLoadConfigDBInitSQL(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "DB_INIT_SQL" {
+			return "SET TIME ZONE 'UTC'; SET statement_timeout = 5000;"
+		}
+		return ""
+	}
+	cfg, err := loadConfig(getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"SET TIME ZONE 'UTC'", "SET statement_timeout = 5000"}
+	if !reflect.DeepEqual(cfg.DBInitSQL, expected) {
+		t.Errorf("got %q want %q", cfg.DBInitSQL, expected)
+	}
+}
+
+func TestLoadConfigRouteConcurrency(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "ROUTE_CONCURRENCY" {
+			return "/birds/backup.zip=1, /bird/{id}/qr=10"
+		}
+		return ""
+	}
+	cfg, err := loadConfig(getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{"/birds/backup.zip": 1, "/bird/{id}/qr": 10}
+	if !reflect.DeepEqual(cfg.RouteConcurrency, expected) {
+		t.Errorf("RouteConcurrency should be %v, got %v", expected, cfg.RouteConcurrency)
+	}
+
+	for _, invalid := range []string{"/birds.rss", "/birds.rss=0", "=1"} {
+		getenv := func(key string) string {
+			if key == "ROUTE_CONCURRENCY" {
+				return invalid
+			}
+			return ""
+		}
+		if _, err := loadConfig(getenv); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestResolveAddr(t *testing.T) {
+	withPort := func(key string) string {
+		if key == "PORT" {
+			return "3000"
+		}
+		return ""
+	}
+	noPort := func(string) string { return "" }
+
+	tests := []struct {
+		name     string
+		flagAddr string
+		flagSet  bool
+		getenv   func(string) string
+		expected string
+	}{
+		{"default", defaultAddr, false, noPort, ":8080"},
+		{"PORT", defaultAddr, false, withPort, ":3000"},
+		{"flag", "127.0.0.1:9000", true, noPort, "127.0.0.1:9000"},
+		{"flag over PORT", "127.0.0.1:9000", true, withPort, "127.0.0.1:9000"},
+	}
+
+	for _, tt := range tests {
+		if addr := resolveAddr(tt.flagAddr, tt.flagSet, tt.getenv); addr != tt.expected {
+			t.Errorf("%s: address should be %q, got %q", tt.name, tt.expected, addr)
+		}
+	}
+}
+
+func TestUseTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		expected bool
+		isValid  bool
+	}{
+		{"both", "cert.pem", "key.pem", true, true},
+		{"neither", "", "", false, true},
+		{"only the certificate", "cert.pem", "", false, false},
+		{"only the key", "", "key.pem", false, false},
+	}
+
+	for _, tt := range tests {
+		enabled, err := useTLS(tt.certFile, tt.keyFile)
+		if (err == nil) != tt.isValid {
+			t.Errorf("%s: expected valid=%v, got error %v", tt.name, tt.isValid, err)
+		}
+		if enabled != tt.expected {
+			t.Errorf("%s: expected TLS to be %v, got %v", tt.name, tt.expected, enabled)
+		}
+	}
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	server := newHTTPServer(":9000", http.HandlerFunc(handler), defaultServerTimeouts)
+	if server.Addr != ":9000" || server.Handler == nil {
+		t.Errorf("the server should listen on the address with the handler, got %q", server.Addr)
+	}
+	if server.ReadTimeout != 15*time.Second || server.WriteTimeout != 15*time.Second || server.IdleTimeout != 60*time.Second {
+		t.Errorf("expected the default timeouts of 15s/15s/60s, got %v/%v/%v",
+			server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+
+	server = newHTTPServer(":9000", http.HandlerFunc(handler), serverTimeouts{Read: time.Second, Write: 2 * time.Second, Idle: 3 * time.Second})
+	if server.ReadTimeout != time.Second || server.WriteTimeout != 2*time.Second || server.IdleTimeout != 3*time.Second {
+		t.Errorf("expected the given timeouts, got %v/%v/%v", server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	}
+}
+
+func TestLoadConfigCacheControl(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "CACHE_CONTROL" {
+			return "GET /bird=public, max-age=60; post /bird=no-store"
+		}
+		return ""
+	}
+	cfg, err := loadConfig(getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"GET /bird": "public, max-age=60", "POST /bird": "no-store"}
+	if !reflect.DeepEqual(cfg.CacheControl, expected) {
+		t.Errorf("CacheControl should be %v, got %v", expected, cfg.CacheControl)
+	}
+
+	for _, invalid := range []string{"/bird=no-store", "GET /bird", "GET bird=no-store"} {
+		getenv := func(key string) string {
+			if key == "CACHE_CONTROL" {
+				return invalid
+			}
+			return ""
+		}
+		if _, err := loadConfig(getenv); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadConfigRateLimit(t *testing.T) {
+	env := map[string]string{"RATE_LIMIT": "2.5"}
+	cfg, err := loadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimit != 2.5 || cfg.RateLimitBurst != 3 {
+		t.Errorf("expected a limit of 2.5 with a burst of 3, got %v and %d", cfg.RateLimit, cfg.RateLimitBurst)
+	}
+
+	env["RATE_LIMIT_BURST"] = "10"
+	if cfg, err = loadConfig(func(key string) string { return env[key] }); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimitBurst != 10 {
+		t.Errorf("expected a burst of 10, got %d", cfg.RateLimitBurst)
+	}
+
+	env["RATE_LIMIT_BURST"] = "0"
+	if _, err := loadConfig(func(key string) string { return env[key] }); err == nil {
+		t.Errorf("expected an error for a burst of 0")
+	}
+}
+
+func TestLoadConfigExportFormats(t *testing.T) {
+	cfg, err := loadConfig(func(key string) string {
+		return map[string]string{"EXPORT_FORMATS": "CSV, ndjson"}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.ExportFormats, []string{"csv", "ndjson"}) {
+		t.Errorf("expected csv and ndjson, got %v", cfg.ExportFormats)
+	}
+
+	if _, err := loadConfig(func(key string) string {
+		return map[string]string{"EXPORT_FORMATS": "json,yaml"}[key]
+	}); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestLoadConfigBodyLog(t *testing.T) {
+	env := map[string]string{"DEBUG": "true", "BODY_LOG_ROUTES": "/bird, /birds", "BODY_LOG_MAX_BYTES": "256"}
+	cfg, err := loadConfig(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Debug || !reflect.DeepEqual(cfg.BodyLogRoutes, []string{"/bird", "/birds"}) || cfg.BodyLogMaxBytes != 256 {
+		t.Errorf("unexpected body logging settings: %v %v %d", cfg.Debug, cfg.BodyLogRoutes, cfg.BodyLogMaxBytes)
+	}
+
+	env["BODY_LOG_MAX_BYTES"] = "0"
+	if _, err := loadConfig(func(key string) string { return env[key] }); err == nil {
+		t.Errorf("expected an error for a size of 0")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// initSQLConnector wraps the connector of a database driver, and runs a list
+// of statements on every new connection before the pool hands it out. This is
+// where per-session settings such as the `timezone`, `search_path` or
+// `statement_timeout` are applied
+type initSQLConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c *initSQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.statements) == 0 {
+		return conn, nil
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("the database driver cannot run the connection init SQL")
+	}
+	for _, statement := range c.statements {
+		if _, err := execer.ExecContext(ctx, statement, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("running connection init SQL %q: %v", statement, err)
+		}
+	}
+	return conn, nil
+}
+
+// openDB opens a pool of postgres connections, each of which runs the
+// `initSQL` statements when it is established
+func openDB(dataSourceName string, initSQL []string) (*sql.DB, error) {
+	connector, err := pq.NewConnector(dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&initSQLConnector{Connector: connector, statements: initSQL}), nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connLimiter caps the number of connections that each client IP can have
+// open at the same time, so that a single client can't use up all of the
+// connections of the server. It is installed as the `ConnState` hook of the
+// server, which sees every connection as it is accepted and closed. The IP is
+// the one of the TCP peer, since there are no headers to read yet: behind a
+// reverse proxy, the limit applies to the proxy
+type connLimiter struct {
+	max int
+
+	// The hook is called from the goroutine of each connection, so the maps
+	// are guarded by the mutex
+	mu sync.Mutex
+	// open counts the connections of each IP
+	open map[string]int
+	// accepted are the connections that count towards the limit. Connections
+	// over the limit are closed straight away, and are not in it
+	accepted map[net.Conn]string
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{
+		max:      max,
+		open:     map[string]int{},
+		accepted: map[net.Conn]string{},
+	}
+}
+
+// ConnState is the `http.Server.ConnState` hook
+func (l *connLimiter) ConnState(conn net.Conn, state http.ConnState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch state {
+	case http.StateNew:
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			ip = conn.RemoteAddr().String()
+		}
+		if l.open[ip] >= l.max {
+			conn.Close()
+			return
+		}
+		l.open[ip]++
+		l.accepted[conn] = ip
+	case http.StateClosed, http.StateHijacked:
+		ip, ok := l.accepted[conn]
+		if !ok {
+			return
+		}
+		delete(l.accepted, conn)
+		if l.open[ip]--; l.open[ip] == 0 {
+			delete(l.open, ip)
+		}
+	}
+}
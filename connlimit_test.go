@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnLimiter(t *testing.T) {
+	mockServer := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	mockServer.Config.ConnState = newConnLimiter(2).ConnState
+	mockServer.Start()
+	defer mockServer.Close()
+
+	// get sends a request on the connection, and tells whether it was answered
+	get := func(conn net.Conn) bool {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("GET /hello HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+			return false
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", mockServer.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	// The connections up to the limit are served, and kept open...
+	for i := 0; i < 2; i++ {
+		conn := dial()
+		defer conn.Close()
+		if !get(conn) {
+			t.Fatalf("connection %d should have been served", i+1)
+		}
+	}
+
+	// ...so the next one from the same IP is over the limit
+	conn := dial()
+	if get(conn) {
+		t.Error("connection over the limit should have been closed")
+	}
+	conn.Close()
+}
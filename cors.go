@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsMiddleware lets pages served from `origin` (such as
+// "https://app.example.com", or "*" for any page) call the API from the
+// browser. Every response tells the browser which origin, methods and headers
+// are allowed, and the preflight `OPTIONS` requests that browsers send before
+// anything but a simple GET are answered right away with 204 No Content. The
+// methods are looked up on `router`, like for `optionsMiddleware`
+func corsMiddleware(origin string, router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestOrigin := r.Header.Get("Origin")
+		if requestOrigin == "" || (origin != "*" && requestOrigin != origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods := allowedMethods(router, r)
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if origin != "*" {
+			// Caches must not give the response to pages from other origins
+			w.Header().Add("Vary", "Origin")
+		}
+		if len(methods) > 0 {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		}
+		w.Header().Set("Access-Control-Allow-Headers", "Accept-Version, Authorization, Content-Type, "+config.RequestIDHeader)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" && len(methods) > 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	r := newRouter(srv)
+	hf := corsMiddleware("https://app.example.com", r, r)
+
+	tests := []struct {
+		method         string
+		origin         string
+		expectedStatus int
+		expectedOrigin string
+		expectedAllow  string
+	}{
+		// The preflight request is answered by the middleware...
+		{"OPTIONS", "https://app.example.com", http.StatusNoContent, "https://app.example.com", "DELETE, GET, HEAD, OPTIONS, POST"},
+		// ...and the actual request is let through, with the same headers
+		{"GET", "https://app.example.com", http.StatusOK, "https://app.example.com", "DELETE, GET, HEAD, OPTIONS, POST"},
+		// Other origins aren't allowed
+		{"GET", "https://evil.example.com", http.StatusOK, "", ""},
+		// Requests that don't come from a browser page have no origin
+		{"GET", "", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "/bird", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s from %q: wrong status code: got %v want %v", tt.method, tt.origin, status, tt.expectedStatus)
+		}
+		if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != tt.expectedOrigin {
+			t.Errorf("%s from %q: wrong Access-Control-Allow-Origin: got %q want %q", tt.method, tt.origin, origin, tt.expectedOrigin)
+		}
+		if allow := recorder.Header().Get("Access-Control-Allow-Methods"); allow != tt.expectedAllow {
+			t.Errorf("%s from %q: wrong Access-Control-Allow-Methods: got %q want %q", tt.method, tt.origin, allow, tt.expectedAllow)
+		}
+		if tt.expectedOrigin != "" && recorder.Header().Get("Access-Control-Allow-Headers") == "" {
+			t.Errorf("%s from %q: missing Access-Control-Allow-Headers", tt.method, tt.origin)
+		}
+	}
+}
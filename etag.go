@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// bufferedResponse holds back the status and body written by a handler, so
+// that they can be looked at before being sent. Headers still go to the
+// underlying writer
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// etagMiddleware tags successful responses with an `ETag`, an FNV hash of the
+// body, and answers 304 Not Modified without a body when it matches the
+// `If-None-Match` of the request, so that clients polling a list that hasn't
+// changed don't download it again
+func etagMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffered := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buffered, r)
+		if buffered.status == 0 {
+			return
+		}
+		if buffered.status != http.StatusOK {
+			w.WriteHeader(buffered.status)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		hash := fnv.New64a()
+		hash.Write(buffered.body.Bytes())
+		etag := fmt.Sprintf(`"%x"`, hash.Sum64())
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buffered.body.Bytes())
+	})
+}
+
+// etagMatches tells if the `If-None-Match` header lists `etag`, or is "*".
+// Weak tags, as in `W/"abc"`, are compared as strong ones, since the body is
+// the same either way
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetBirdsETag(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow", Description: "A small harmless bird"}}, nil).Twice()
+
+	router := newRouter(srv)
+
+	req, err := http.NewRequest("GET", "/bird", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	etag := recorder.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag header")
+	}
+	if recorder.Body.Len() == 0 {
+		t.Errorf("expected the birds in the body")
+	}
+
+	// The client already has this list, so it isn't sent again
+	req.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusNotModified {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotModified)
+	}
+	if recorder.Body.Len() != 0 {
+		t.Errorf("expected no body, got %q", recorder.Body.String())
+	}
+	if recorder.Header().Get("ETag") != etag {
+		t.Errorf("expected the same ETag, got %q want %q", recorder.Header().Get("ETag"), etag)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`*`, true},
+		{`"xyz"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, `"abc"`); got != tt.expected {
+			t.Errorf("%q: got %v want %v", tt.ifNoneMatch, got, tt.expected)
+		}
+	}
+}
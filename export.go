@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// birdWriter writes the birds of an export one at a time, so that the export
+// never has to fit in memory. `Close` finishes the document, and must be
+// called even when there were no birds
+type birdWriter interface {
+	Write(bird *Bird) error
+	Close() error
+}
+
+// exportFormat is one of the formats that `/birds/export` can produce
+type exportFormat struct {
+	// name is what clients give in the `format` query parameter, and the
+	// extension of the file name suggested to them
+	name string
+	// mediaType is what clients give in the `Accept` header
+	mediaType   string
+	contentType func() string
+	newWriter   func(w io.Writer) birdWriter
+}
+
+// exportFormats are every format that exports can be made in, by name. The
+// ones actually served are picked in the configuration
+var exportFormats = map[string]exportFormat{
+	"json": {
+		name:        "json",
+		mediaType:   "application/json",
+		contentType: jsonContentType,
+		newWriter:   func(w io.Writer) birdWriter { return &jsonBirdWriter{w: w} },
+	},
+	"ndjson": {
+		name:        "ndjson",
+		mediaType:   "application/x-ndjson",
+		contentType: func() string { return "application/x-ndjson" },
+		newWriter:   func(w io.Writer) birdWriter { return ndjsonBirdWriter{json.NewEncoder(w)} },
+	},
+	"csv": {
+		name:        "csv",
+		mediaType:   "text/csv",
+		contentType: func() string { return "text/csv; charset=utf-8" },
+		newWriter:   func(w io.Writer) birdWriter { return newCSVBirdWriter(w, csvExportColumns) },
+	},
+	"xml": {
+		name:        "xml",
+		mediaType:   "application/xml",
+		contentType: func() string { return "application/xml; charset=utf-8" },
+		newWriter:   func(w io.Writer) birdWriter { return &xmlBirdWriter{w: w, encoder: xml.NewEncoder(w)} },
+	},
+}
+
+// defaultExportFormats are the formats served when the configuration doesn't
+// name any, in order of preference
+var defaultExportFormats = []string{"json", "csv", "ndjson", "xml"}
+
+// negotiateExportFormat picks the format of an export. The `format` query
+// parameter wins over the `Accept` header, since it is what links to a
+// download can set. Between the formats that the header accepts, the first
+// one of the configuration is used. It returns false when none of the
+// configured formats was asked for
+func negotiateExportFormat(r *http.Request) (exportFormat, bool) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, configured := range config.ExportFormats {
+			if configured == strings.ToLower(name) {
+				return exportFormats[configured], true
+			}
+		}
+		return exportFormat{}, false
+	}
+	for _, name := range config.ExportFormats {
+		if format := exportFormats[name]; acceptsMediaType(r.Header.Get("Accept"), format.mediaType) {
+			return format, true
+		}
+	}
+	return exportFormat{}, false
+}
+
+// exportBirdsHandler streams every bird, in the format negotiated with the
+// client. Clients asking for a format that isn't served get 406 Not
+// Acceptable, with the list of the formats that are
+func (s *Server) exportBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+	format, ok := negotiateExportFormat(r)
+	if !ok {
+		w.Header().Set("Content-Type", jsonContentType())
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":     "exports are only available as " + strings.Join(config.ExportFormats, ", "),
+			"supported": config.ExportFormats,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="birds.%s"`, format.name))
+
+	writer := format.newWriter(w)
+	err := s.store.EachBird(r.Context(), writer.Write)
+	if err == nil {
+		err = writer.Close()
+	}
+	// Like with backups, the status can't be changed anymore once the export
+	// has started streaming, and the client is left with a truncated document
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+	}
+}
+
+// exportBirdsCSVHandler responds with the ID, species and description of
+// every bird as CSV, for spreadsheets. The rows are written to the response
+// as the birds are read from the store, rather than building the whole file
+// first
+func (s *Server) exportBirdsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=birds.csv")
+
+	writer := newCSVBirdWriter(w, csvSpreadsheetColumns)
+	err := s.store.EachBird(r.Context(), writer.Write)
+	if err == nil {
+		err = writer.Close()
+	}
+	// The response has already started, so a failure can only be logged
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+	}
+}
+
+// jsonBirdWriter writes the birds as a JSON array
+type jsonBirdWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonBirdWriter) Write(bird *Bird) error {
+	body, err := json.Marshal(bird)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if j.count == 0 {
+		sep = "["
+	}
+	j.count++
+	_, err = io.WriteString(j.w, sep+string(body))
+	return err
+}
+
+func (j *jsonBirdWriter) Close() error {
+	end := "]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonBirdWriter writes each bird as a JSON object on a line of its own
+type ndjsonBirdWriter struct {
+	encoder *json.Encoder
+}
+
+func (n ndjsonBirdWriter) Write(bird *Bird) error {
+	return n.encoder.Encode(bird)
+}
+
+func (n ndjsonBirdWriter) Close() error {
+	return nil
+}
+
+// csvColumn is a column of the CSV exports, named like the JSON field
+type csvColumn struct {
+	name  string
+	value func(bird *Bird) string
+}
+
+var (
+	csvIDColumn          = csvColumn{"id", func(bird *Bird) string { return strconv.Itoa(bird.ID) }}
+	csvSpeciesColumn     = csvColumn{"species", func(bird *Bird) string { return bird.Species }}
+	csvDescriptionColumn = csvColumn{"description", func(bird *Bird) string { return bird.Description }}
+	csvCreatedAtColumn   = csvColumn{"created_at", func(bird *Bird) string { return bird.CreatedAt.Format(time.RFC3339Nano) }}
+	csvUpdatedAtColumn   = csvColumn{"updated_at", func(bird *Bird) string { return bird.UpdatedAt.Format(time.RFC3339Nano) }}
+)
+
+// csvExportColumns are the columns of `/birds/export`, and
+// csvSpreadsheetColumns the ones of `/bird/export`. Only the latter escape
+// formulas, since the former is read back by programs, which must get the
+// data as it is
+var (
+	csvExportColumns      = []csvColumn{csvIDColumn, csvSpeciesColumn, csvDescriptionColumn, csvCreatedAtColumn, csvUpdatedAtColumn}
+	csvSpreadsheetColumns = []csvColumn{csvIDColumn, csvSpeciesColumn.escapeFormulas(), csvDescriptionColumn.escapeFormulas()}
+)
+
+// escapeFormulas returns the column with its cells passed through
+// `escapeCSVFormula`
+func (c csvColumn) escapeFormulas() csvColumn {
+	return csvColumn{c.name, func(bird *Bird) string { return escapeCSVFormula(c.value(bird)) }}
+}
+
+// csvBirdWriter writes the birds as CSV records of `columns`, after a header
+// naming them
+type csvBirdWriter struct {
+	w           *csv.Writer
+	columns     []csvColumn
+	wroteHeader bool
+}
+
+func newCSVBirdWriter(w io.Writer, columns []csvColumn) *csvBirdWriter {
+	return &csvBirdWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+func (c *csvBirdWriter) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		record[i] = column.name
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvBirdWriter) Write(bird *Bird) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		record[i] = column.value(bird)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvBirdWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeCSVFormula keeps spreadsheets from running a cell as a formula, such
+// as a species of `=HYPERLINK(...)`, by prefixing the cells that start like
+// one with `'`. Some spreadsheets also skip a leading tab or carriage return
+// before looking for the formula
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// xmlBirdWriter writes the birds in a `<birds>` element, like the XML
+// responses of `/bird`
+type xmlBirdWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+var xmlBirdsStart = xml.StartElement{Name: xml.Name{Local: "birds"}}
+
+func (x *xmlBirdWriter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	if _, err := io.WriteString(x.w, xml.Header); err != nil {
+		return err
+	}
+	return x.encoder.EncodeToken(xmlBirdsStart)
+}
+
+func (x *xmlBirdWriter) Write(bird *Bird) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.encoder.Encode(bird)
+}
+
+func (x *xmlBirdWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	if err := x.encoder.EncodeToken(xmlBirdsStart.End()); err != nil {
+		return err
+	}
+	return x.encoder.Flush()
+}
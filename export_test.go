@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportBirdsHandler(t *testing.T) {
+	exported := []*Bird{
+		{ID: 1, Species: "sparrow", Description: "A small harmless bird"},
+		{ID: 7, Species: "eagle", Description: "A bird of prey, with a hooked beak"},
+	}
+
+	tests := []struct {
+		name                string
+		query               string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		// Without a preference, the first configured format is used
+		{"default", "", "", http.StatusOK, "application/json; charset=utf-8"},
+		{"any type", "", "*/*", http.StatusOK, "application/json; charset=utf-8"},
+		{"accept csv", "", "text/csv", http.StatusOK, "text/csv; charset=utf-8"},
+		{"accept ndjson", "", "application/x-ndjson", http.StatusOK, "application/x-ndjson"},
+		{"accept xml", "", "application/xml", http.StatusOK, "application/xml; charset=utf-8"},
+		{"accept several", "", "application/xml, text/csv", http.StatusOK, "text/csv; charset=utf-8"},
+		// The query parameter wins over the header
+		{"format param", "?format=ndjson", "application/xml", http.StatusOK, "application/x-ndjson"},
+		{"format param case", "?format=CSV", "", http.StatusOK, "text/csv; charset=utf-8"},
+		{"unknown format", "?format=yaml", "", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{"unknown type", "", "application/pdf", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{"refused type", "", "application/json;q=0, text/*;q=0, application/*;q=0", http.StatusNotAcceptable, "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		mockStore := InitMockStore()
+		mockStore.On("EachBird").Return(exported, nil).Maybe()
+		srv := newServer(mockStore)
+
+		req := httptest.NewRequest("GET", "/birds/export"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		recorder := httptest.NewRecorder()
+		newRouter(srv).ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, recorder.Code, tt.expectedStatus)
+			continue
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+			t.Errorf("%s: handler returned wrong content type: got %q want %q", tt.name, contentType, tt.expectedContentType)
+		}
+		if recorder.Code == http.StatusOK {
+			if species := exportedSpecies(t, recorder); strings.Join(species, ",") != "sparrow,eagle" {
+				t.Errorf("%s: incorrect birds, wanted sparrow and eagle, got %v", tt.name, species)
+			}
+		}
+	}
+}
+
+// exportedSpecies decodes the export in `recorder`, whatever its format, and
+// returns the species of its birds in order
+func exportedSpecies(t *testing.T, recorder *httptest.ResponseRecorder) []string {
+	var birds []Bird
+	var err error
+	switch strings.Split(recorder.Header().Get("Content-Type"), ";")[0] {
+	case "application/json":
+		err = json.Unmarshal(recorder.Body.Bytes(), &birds)
+	case "application/x-ndjson":
+		for _, line := range strings.Split(strings.TrimSpace(recorder.Body.String()), "\n") {
+			var bird Bird
+			if err = json.Unmarshal([]byte(line), &bird); err != nil {
+				break
+			}
+			birds = append(birds, bird)
+		}
+	case "application/xml":
+		var list struct {
+			Birds []Bird `xml:"bird"`
+		}
+		err = xml.Unmarshal(recorder.Body.Bytes(), &list)
+		birds = list.Birds
+	case "text/csv":
+		var records [][]string
+		records, err = csv.NewReader(recorder.Body).ReadAll()
+		if err == nil && (len(records) == 0 || records[0][1] != "species") {
+			t.Fatalf("the CSV export should start with a header, got %v", records)
+		}
+		for _, record := range records[1:] {
+			birds = append(birds, Bird{Species: record[1], Description: record[2]})
+		}
+	}
+	if err != nil {
+		t.Fatalf("could not decode the export: %v\n%s", err, recorder.Body.String())
+	}
+
+	species := []string{}
+	for _, bird := range birds {
+		species = append(species, bird.Species)
+	}
+	return species
+}
+
+func TestExportBirdsHandlerConfiguredFormats(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.ExportFormats = []string{"csv", "json"}
+
+	mockStore := InitMockStore()
+	mockStore.On("EachBird").Return([]*Bird{}, nil)
+	router := newRouter(newServer(mockStore))
+
+	// The formats that aren't configured are refused, even if they exist
+	req := httptest.NewRequest("GET", "/birds/export?format=xml", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNotAcceptable {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusNotAcceptable)
+	}
+	var body struct {
+		Supported []string `json:"supported"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(body.Supported, ",") != "csv,json" {
+		t.Errorf("the configured formats should be listed, got %v", body.Supported)
+	}
+
+	// The configured order decides when the client takes anything, and an
+	// empty export is still a valid document
+	req = httptest.NewRequest("GET", "/birds/export", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Errorf("handler returned wrong content type: got %q want %q", contentType, "text/csv; charset=utf-8")
+	}
+	if body := recorder.Body.String(); body != "id,species,description,created_at,updated_at\n" {
+		t.Errorf("expected only the CSV header, got %q", body)
+	}
+}
+
+func TestExportBirdsCSVHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	birds := []*Bird{
+		{ID: 1, Species: "sparrow", Description: "A small harmless bird"},
+		{ID: 7, Species: "eagle", Description: "A bird of prey, with a \"hooked\" beak"},
+		// Cells that a spreadsheet would run as formulas are escaped
+		{ID: 9, Species: `=HYPERLINK("http://example.com")`, Description: "@SUM(A1:A2)"},
+		{ID: 10, Species: "+1", Description: "-1"},
+		{ID: 11, Species: "\t=1+1", Description: "\r=1+1"},
+	}
+	mockStore.On("EachBird").Return(birds, nil).Once()
+
+	req := httptest.NewRequest("GET", "/bird/export", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(srv).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if disposition := recorder.Header().Get("Content-Disposition"); disposition != "attachment; filename=birds.csv" {
+		t.Errorf("handler returned wrong Content-Disposition: %q", disposition)
+	}
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"id", "species", "description"},
+		{"1", "sparrow", "A small harmless bird"},
+		{"7", "eagle", `A bird of prey, with a "hooked" beak`},
+		{"9", `'=HYPERLINK("http://example.com")`, "'@SUM(A1:A2)"},
+		{"10", "'+1", "'-1"},
+		{"11", "'\t=1+1", "'\r=1+1"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("unexpected rows: got %q want %q", records, expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestExportBirdsHandlerCSVKeepsData(t *testing.T) {
+	mockStore := InitMockStore()
+	// Only the spreadsheet export escapes formulas. The data export is read
+	// back by programs, and must not be changed
+	mockStore.On("EachBird").Return([]*Bird{{ID: 1, Species: "=sparrow", Description: "-shy bird"}}, nil).Once()
+
+	req := httptest.NewRequest("GET", "/birds/export?format=csv", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(newServer(mockStore)).ServeHTTP(recorder, req)
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "=sparrow" || records[1][2] != "-shy bird" {
+		t.Errorf("the exported bird should be unchanged, got %q", records)
+	}
+
+	mockStore.AssertExpectations(t)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// FacetedPage is a page of the birds matching a filter, along with counts
+// over every matching bird, and not only the ones of the page, for the
+// facets of a search UI
+type FacetedPage struct {
+	*Page[Bird]
+	Facets Facets `json:"facets"`
+}
+
+// Facets count the matching birds by the value of their fields
+type Facets struct {
+	// Species is the number of matching birds of each species
+	Species map[string]int `json:"species"`
+}
+
+func (store *dbStore) GetBirdsPageWithFacets(ctx context.Context, opts QueryOptions, limit, offset int) (*FacetedPage, error) {
+	where, args := opts.where()
+	facets := Facets{Species: map[string]int{}}
+	var birds []*Bird
+
+	// Both queries read from the same snapshot, so that the page and the
+	// counts always agree. The total is the sum of the counts, which saves
+	// counting the matching birds a second time
+	snapshot := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	err := store.withTxOptions(ctx, snapshot, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT species, COUNT(*) FROM birds"+where+" GROUP BY species", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var species sql.NullString
+			var count int
+			if err := rows.Scan(&species, &count); err != nil {
+				return err
+			}
+			facets.Species[species.String] += count
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		n := len(args)
+		rows, err = tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM birds%s ORDER BY id LIMIT $%d OFFSET $%d", birdColumns, where, n+1, n+2),
+			append(args, limit, offset)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		birds, err = scanBirds(rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, count := range facets.Species {
+		total += count
+	}
+	return &FacetedPage{Page: newPage(birds, total, limit, offset), Facets: facets}, nil
+}
+
+// pageParams reads the `limit` (`defaultPageLimit` by default, and at most
+// `maxPageLimit`) and `offset` (0 by default) query parameters of a page
+func pageParams(query url.Values) (limit, offset int, err error) {
+	limit = defaultPageLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("limit must be a positive number")
+		}
+	}
+	// Larger pages are cut down rather than refused, so that clients asking
+	// for "everything" still get a page, and can follow the links for more
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a number, and not negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// writeFacetedPage responds with the page of the birds matching the filter of
+// the query parameters, such as `?facets=species&species=eagle&limit=10`,
+// along with the counts of the facets. Only species can be counted for now
+func (s *Server) writeFacetedPage(w http.ResponseWriter, r *http.Request) {
+	if facets := r.URL.Query().Get("facets"); facets != "species" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("facets must be species, got %q", facets))
+		return
+	}
+	limit, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := s.store.GetBirdsPageWithFacets(r.Context(), queryOptionsFromURL(r.URL.Query()), limit, offset)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	page.setLinks(r.URL)
+	marshalBirds(w, page, wantsPretty(r))
+}
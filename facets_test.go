@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetBirdsFacetsHandler(t *testing.T) {
+	s := newMemStore()
+	if err := s.CreateBirds(context.Background(), []*Bird{{Species: "sparrow"}, {Species: "eagle"}, {Species: "swift"}}); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(newServer(s))
+
+	tests := []struct {
+		query          string
+		expectedIDs    []int
+		expectedTotal  int
+		expectedFacets map[string]int
+	}{
+		// The counts are over every bird, and not only the ones of the page
+		{"?facets=species&limit=1", []int{1}, 3, map[string]int{"sparrow": 1, "eagle": 1, "swift": 1}},
+		{"?facets=species&limit=1&offset=2", []int{3}, 3, map[string]int{"sparrow": 1, "eagle": 1, "swift": 1}},
+		// ...but only over the birds matching the filter
+		{"?facets=species&species=eagle", []int{2}, 1, map[string]int{"eagle": 1}},
+		{"?facets=species&species=dodo", []int{}, 0, map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/bird"+tt.query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.query, status, http.StatusOK)
+			continue
+		}
+		var page FacetedPage
+		if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		ids := []int{}
+		for _, bird := range page.Items {
+			ids = append(ids, bird.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.expectedIDs) || page.Total != tt.expectedTotal {
+			t.Errorf("%s: unexpected page, wanted birds %v out of %d, got %v out of %d", tt.query, tt.expectedIDs, tt.expectedTotal, ids, page.Total)
+		}
+		if !reflect.DeepEqual(page.Facets.Species, tt.expectedFacets) {
+			t.Errorf("%s: unexpected facets, wanted %v, got %v", tt.query, tt.expectedFacets, page.Facets.Species)
+		}
+	}
+}
+
+func TestGetBirdsFacetsHandlerInvalid(t *testing.T) {
+	router := newRouter(newServer(newMemStore()))
+
+	for _, query := range []string{"facets=description", "facets=species&limit=0", "facets=species&offset=-1"} {
+		req := httptest.NewRequest("GET", "/bird?"+query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if status := recorder.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
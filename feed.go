@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rssFeed is the document of an RSS 2.0 feed, with the fields feed readers
+// need
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Description string `xml:"description"`
+	// GUID identifies the item for readers, so that they don't show the same
+	// bird twice. It isn't a link to the bird, hence `isPermaLink="false"`
+	GUID    rssGUID `xml:"guid"`
+	PubDate string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// siteURL is the URL that the links to the site start with, such as
+// "https://example.com". It is on the canonical host when there is one, and
+// on the host the request was made to otherwise
+func siteURL(r *http.Request) string {
+	host := r.Host
+	if config.CanonicalHost != "" {
+		host = config.CanonicalHost
+	}
+	return requestScheme(r) + "://" + host
+}
+
+// feedHandler responds with an RSS feed of the most recently created birds,
+// so that they can be followed in a feed reader
+func (s *Server) feedHandler(w http.ResponseWriter, r *http.Request) {
+	birds, err := s.store.RecentBirds(r.Context(), config.FeedSize)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Bird encyclopedia",
+			Link:        siteURL(r) + "/assets/",
+			Description: "The latest birds added to the encyclopedia",
+			Items:       []rssItem{},
+		},
+	}
+	for _, bird := range birds {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       bird.Species,
+			Description: bird.Description,
+			GUID:        rssGUID{Value: "bird-" + strconv.Itoa(bird.ID)},
+			PubDate:     bird.CreatedAt.Format(time.RFC1123Z),
+		})
+	}
+
+	feedBytes, err := xml.Marshal(feed)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(feedBytes)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeedHandler(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.FeedSize = 2
+
+	created := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("RecentBirds", 2).Return([]*Bird{
+		{ID: 7, Species: "eagle", Description: "A bird of prey", CreatedAt: created},
+		{ID: 1, Species: "sparrow", Description: "A small harmless bird", CreatedAt: created},
+	}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds.rss", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.feedHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	feed := rssFeed{}
+	if err := xml.NewDecoder(recorder.Body).Decode(&feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Version != "2.0" {
+		t.Errorf("feed should be RSS 2.0, got version %q", feed.Version)
+	}
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("feed should have 2 items, got %d", len(feed.Channel.Items))
+	}
+	item := feed.Channel.Items[0]
+	if item.Title != "eagle" || item.Description != "A bird of prey" || item.GUID.Value != "bird-7" {
+		t.Errorf("feed has the wrong first item: %+v", item)
+	}
+	if item.PubDate != "Wed, 02 Jan 2019 03:04:05 +0000" {
+		t.Errorf("item has the wrong publication date: %q", item.PubDate)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestFeedHandlerLink(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	trusted, err := parseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TrustedProxies = trusted
+
+	tests := []struct {
+		name          string
+		canonicalHost string
+		remoteAddr    string
+		tls           bool
+		proto         string
+		expectedLink  string
+	}{
+		{"plain HTTP", "", "203.0.113.7:5123", false, "", "http://birds.example/assets/"},
+		{"TLS", "", "203.0.113.7:5123", true, "", "https://birds.example/assets/"},
+		{"trusted proxy", "", "10.1.2.3:80", false, "https", "https://birds.example/assets/"},
+		// Anyone else can't make the link HTTPS...
+		{"untrusted proxy", "", "203.0.113.7:5123", false, "https", "http://birds.example/assets/"},
+		// ...nor point it at another host, when there is a canonical one
+		{"canonical host", "example.com", "203.0.113.7:5123", true, "", "https://example.com/assets/"},
+	}
+
+	for _, tt := range tests {
+		config.CanonicalHost = tt.canonicalHost
+		mockStore := InitMockStore()
+		mockStore.On("RecentBirds", config.FeedSize).Return([]*Bird{}, nil).Once()
+
+		req := httptest.NewRequest("GET", "http://birds.example/birds.rss", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if tt.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(newServer(mockStore).feedHandler).ServeHTTP(recorder, req)
+
+		feed := rssFeed{}
+		if err := xml.NewDecoder(recorder.Body).Decode(&feed); err != nil {
+			t.Fatal(err)
+		}
+		if feed.Channel.Link != tt.expectedLink {
+			t.Errorf("%s: wrong channel link: got %q want %q", tt.name, feed.Channel.Link, tt.expectedLink)
+		}
+		mockStore.AssertExpectations(t)
+	}
+}
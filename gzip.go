@@ -0,0 +1,105 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseWriter compresses the body written through it, once the status
+// of the response tells that it has a body worth compressing
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+// alreadyCompressed are the content types that gzip can't make any smaller
+var alreadyCompressed = []string{"image/", "application/zip", "application/gzip"}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	if g.compresses(status) {
+		g.Header().Set("Content-Encoding", "gzip")
+		// The length set by the handler is the one of the uncompressed body
+		g.Header().Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+// compresses tells if a response with `status`, and the headers set so far,
+// is to be compressed. Responses without a body, parts of one, and the ones
+// that are already encoded are left alone
+func (g *gzipResponseWriter) compresses(status int) bool {
+	switch {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusPartialContent, status == http.StatusNotModified:
+		return false
+	case g.Header().Get("Content-Encoding") != "":
+		return false
+	}
+	contentType := g.Header().Get("Content-Type")
+	for _, prefix := range alreadyCompressed {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		// Like `net/http`, the content type is sniffed from the first bytes,
+		// before they are compressed out of recognition
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gz == nil {
+		return g.ResponseWriter.Write(p)
+	}
+	return g.gz.Write(p)
+}
+
+// Flush sends what has been compressed so far, for the responses that are
+// streamed
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap gives `http.ResponseController` access to the underlying writer
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Close writes the end of the compressed body, if there is one
+func (g *gzipResponseWriter) Close() error {
+	if g.gz == nil {
+		return nil
+	}
+	return g.gz.Close()
+}
+
+// gzipMiddleware compresses the responses with gzip for the clients that ask
+// for it with `Accept-Encoding`, to save bandwidth on large lists of birds.
+// The others get them as they are
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Caches must keep the compressed and plain responses apart
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !headerAccepts(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
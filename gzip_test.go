@@ -0,0 +1,94 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	body := strings.Repeat(`{"species":"sparrow"},`, 100)
+	h := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType())
+		io.WriteString(w, body)
+	}))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		compressed     bool
+	}{
+		{"no header", "", false},
+		{"gzip", "gzip", true},
+		{"among others", "br, gzip;q=0.8, deflate", true},
+		{"wildcard", "*", true},
+		{"other encoding", "br", false},
+		{"refused", "gzip;q=0, *", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/bird", nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+
+		if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("%s: expected to vary on Accept-Encoding, got %q", tt.name, vary)
+		}
+		if !tt.compressed {
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
+				t.Errorf("%s: expected a plain response, got Content-Encoding %q", tt.name, encoding)
+			}
+			if recorder.Body.String() != body {
+				t.Errorf("%s: expected the body as it is, got %q", tt.name, recorder.Body.String())
+			}
+			continue
+		}
+
+		if encoding := recorder.Header().Get("Content-Encoding"); encoding != "gzip" {
+			t.Errorf("%s: expected Content-Encoding gzip, got %q", tt.name, encoding)
+			continue
+		}
+		if recorder.Body.Len() >= len(body) {
+			t.Errorf("%s: expected a smaller body, got %d bytes for %d", tt.name, recorder.Body.Len(), len(body))
+		}
+		reader, err := gzip.NewReader(recorder.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reading to the end checks the footer written by `Close`
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%s: the body isn't a complete gzip stream: %v", tt.name, err)
+		}
+		if string(decompressed) != body {
+			t.Errorf("%s: unexpected decompressed body: %q", tt.name, decompressed)
+		}
+	}
+}
+
+func TestGzipMiddlewareWithoutBody(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteBird", 1).Return(nil).Once()
+	h := gzipMiddleware(newRouter(srv))
+
+	// A 204 has no body to compress
+	req := httptest.NewRequest("DELETE", "/bird/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusNoContent)
+	}
+	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" || recorder.Body.Len() != 0 {
+		t.Errorf("expected an empty plain response, got Content-Encoding %q and %q", encoding, recorder.Body.String())
+	}
+
+	mockStore.AssertExpectations(t)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// h2cMiddleware serves HTTP/2 without TLS to the clients that ask for it,
+// either with prior knowledge or by upgrading an HTTP/1.1 connection. The
+// requests of the others are passed on to `next` untouched
+func h2cMiddleware(next http.Handler) http.Handler {
+	return h2c.NewHandler(next, &http2.Server{})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// h2cClient speaks HTTP/2 over plain TCP, with prior knowledge that the
+// server understands it
+var h2cClient = &http.Client{Transport: &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	},
+}}
+
+func TestH2CMiddleware(t *testing.T) {
+	server := httptest.NewServer(h2cMiddleware(http.HandlerFunc(handler)))
+	defer server.Close()
+
+	resp, err := h2cClient.Get(server.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("expected a 200 over HTTP/2, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+
+	// HTTP/1.1 clients are still served
+	resp, err = http.Get(server.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 1 {
+		t.Errorf("expected a 200 over HTTP/1.1, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestH2CDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	// Without h2c, the server doesn't understand the HTTP/2 preface
+	if resp, err := h2cClient.Get(server.URL + "/hello"); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected HTTP/2 without TLS to fail, got %s", resp.Proto)
+	}
+}
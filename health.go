@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// draining is set by `POST /admin/drain` ahead of a rolling deploy. The
+// instance keeps serving requests, but reports itself as not ready, so that
+// the load balancer stops sending it new ones
+var draining atomic.Bool
+
+// readyzHandler is the readiness probe. It reports 503 Service Unavailable
+// while the application is starting up, once it has been drained, or when the
+// store fails its self-test, so that no requests are sent to an instance
+// that can't answer them
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType())
+	switch {
+	case !ready.Load():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"starting"}`))
+	case draining.Load():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"draining"}`))
+	default:
+		err := errNoStore
+		if s.store != nil {
+			err = s.store.SelfTest(r.Context())
+		}
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"unhealthy"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"ready"}`))
+	}
+}
+
+// drainHandler takes the instance out of the load balancer, by failing the
+// readiness probe from now on. In-flight and new requests are still served
+// until the orchestrator stops the process
+func drainHandler(w http.ResponseWriter, r *http.Request) {
+	draining.Store(true)
+	w.Header().Set("Content-Type", jsonContentType())
+	w.Write([]byte(`{"status":"draining"}`))
+}
+
+// healthzHandler is the liveness probe. It reports 503 Service Unavailable
+// when the store can't be reached, such as during a database outage. While
+// the application is starting up there is no store to check yet, but the
+// process is alive, so it reports that it is starting
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType())
+	if !ready.Load() {
+		w.Write([]byte(`{"status":"starting"}`))
+		return
+	}
+	err := errNoStore
+	if s.store != nil {
+		err = s.store.Ping(r.Context())
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"status":"unavailable"}`))
+		return
+	}
+	w.Write([]byte(`{"status":"ok"}`))
+}
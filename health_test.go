@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDrain(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.AdminToken = "admin-secret"
+	defer setReady(ready.Load())
+	setReady(true)
+	defer draining.Store(false)
+
+	mockServer := httptest.NewServer(newRouter(newServer(newMemStore())))
+	defer mockServer.Close()
+
+	// readyStatus fetches the readiness probe, and returns its status code
+	readyStatus := func() int {
+		resp, err := http.Get(mockServer.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	drain := func(token string) int {
+		req, err := http.NewRequest("POST", mockServer.URL+"/admin/drain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := readyStatus(); status != http.StatusOK {
+		t.Errorf("Status should be 200 before draining, got %d", status)
+	}
+
+	// Only an admin can drain the instance
+	if status := drain("wrong"); status != http.StatusUnauthorized {
+		t.Errorf("Status should be 401 for a bad token, got %d", status)
+	}
+	if status := readyStatus(); status != http.StatusOK {
+		t.Errorf("Status should still be 200, got %d", status)
+	}
+
+	if status := drain("admin-secret"); status != http.StatusOK {
+		t.Errorf("Status should be 200 for the admin, got %d", status)
+	}
+	if status := readyStatus(); status != http.StatusServiceUnavailable {
+		t.Errorf("Status should be 503 after draining, got %d", status)
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	defer setReady(ready.Load())
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("Ping").Return(nil).Once()
+	mockStore.On("Ping").Return(errors.New("connection refused")).Once()
+
+	tests := []struct {
+		ready          bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		// The store isn't checked while the application is starting up
+		{false, http.StatusOK, `{"status":"starting"}`},
+		{true, http.StatusOK, `{"status":"ok"}`},
+		{true, http.StatusServiceUnavailable, `{"status":"unavailable"}`},
+	}
+
+	hf := http.HandlerFunc(srv.healthzHandler)
+	for _, tt := range tests {
+		setReady(tt.ready)
+		req, err := http.NewRequest("GET", "/healthz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+		}
+		if body := recorder.Body.String(); body != tt.expectedBody {
+			t.Errorf("handler returned unexpected body: got %v want %v", body, tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestReadyzSelfTest(t *testing.T) {
+	defer setReady(ready.Load())
+	setReady(true)
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("SelfTest").Return(nil).Once()
+	mockStore.On("SelfTest").Return(errors.New("relation does not exist")).Once()
+
+	tests := []struct {
+		expectedStatus int
+		expectedBody   string
+	}{
+		{http.StatusOK, `{"status":"ready"}`},
+		{http.StatusServiceUnavailable, `{"status":"unhealthy"}`},
+	}
+
+	hf := http.HandlerFunc(srv.readyzHandler)
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, tt.expectedStatus)
+		}
+		if body := recorder.Body.String(); body != tt.expectedBody {
+			t.Errorf("handler returned unexpected body: got %v want %v", body, tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
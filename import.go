@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ConflictStrategy decides what `ImportBirds` does with a bird whose ID is
+// already taken
+type ConflictStrategy string
+
+const (
+	// ConflictSkip keeps the existing bird, and ignores the imported one
+	ConflictSkip ConflictStrategy = "skip"
+	// ConflictOverwrite replaces the existing bird with the imported one
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// ConflictError fails the whole import
+	ConflictError ConflictStrategy = "error"
+)
+
+// ImportOutcome is what happened to one of the birds given to `ImportBirds`
+type ImportOutcome string
+
+const (
+	ImportCreated     ImportOutcome = "created"
+	ImportSkipped     ImportOutcome = "skipped"
+	ImportOverwritten ImportOutcome = "overwritten"
+)
+
+// ErrBirdExists is returned when a bird is imported with the ID of an existing
+// bird, and the conflict strategy is `ConflictError`
+var ErrBirdExists = errors.New("bird already exists")
+
+// ErrSpeciesExists is returned by the in-memory store when a bird would get
+// the species of another bird, which Postgres refuses with `birds_species_key`
+var ErrSpeciesExists = errors.New("a bird of this species already exists")
+
+// uniqueViolation is the Postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
+// isUniqueViolation tells if `err` is Postgres refusing a row because it
+// duplicates a unique key, such as the ID or the species of another bird, or
+// the same refusal from the in-memory store. The error can be wrapped
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, ErrSpeciesExists) || errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+func (store *dbStore) ImportBirds(ctx context.Context, birds []*Bird, strategy ConflictStrategy) ([]ImportOutcome, error) {
+	var onConflict string
+	switch strategy {
+	case ConflictSkip:
+		onConflict = " ON CONFLICT (id) DO NOTHING"
+	case ConflictOverwrite:
+		onConflict = " ON CONFLICT (id) DO UPDATE SET species = EXCLUDED.species, description = EXCLUDED.description, updated_at = now(), version = birds.version + 1"
+	case ConflictError:
+	default:
+		return nil, fmt.Errorf("unknown conflict strategy %q", strategy)
+	}
+
+	outcomes := make([]ImportOutcome, len(birds))
+	err := store.withTx(ctx, func(tx *sql.Tx) error {
+		for i, bird := range birds {
+			// A bird without an ID can't conflict with anything, so it is
+			// simply given the next one
+			if bird.ID == 0 {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO birds(species, description) VALUES ($1,$2)", bird.Species, bird.Description); err != nil {
+					return err
+				}
+				outcomes[i] = ImportCreated
+				continue
+			}
+
+			// `xmax` is 0 for a row that was just inserted, and set for an
+			// existing row that was updated instead. A skipped row returns
+			// nothing at all
+			var inserted bool
+			err := tx.QueryRowContext(ctx, "INSERT INTO birds(id, species, description) VALUES ($1,$2,$3)"+onConflict+" RETURNING xmax = 0",
+				bird.ID, bird.Species, bird.Description).Scan(&inserted)
+			if isUniqueViolation(err) {
+				return fmt.Errorf("bird %d: %w", bird.ID, ErrBirdExists)
+			}
+			switch {
+			case err == sql.ErrNoRows:
+				outcomes[i] = ImportSkipped
+			case err != nil:
+				return err
+			case inserted:
+				outcomes[i] = ImportCreated
+			default:
+				outcomes[i] = ImportOverwritten
+			}
+		}
+
+		// Inserting explicit IDs doesn't move the ID sequence, so we move it
+		// past them ourselves, or the next bird created would collide
+		_, err := tx.ExecContext(ctx, "SELECT setval(pg_get_serial_sequence('birds', 'id'), (SELECT COALESCE(MAX(id), 0) + 1 FROM birds), false)")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
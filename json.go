@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errTrailingJSON is returned by `decodeJSON` when there is more data after
+// the JSON value in the body
+var errTrailingJSON = errors.New("unexpected data after the JSON value")
+
+// errInternal is what clients are told when something failed on our side. The
+// actual error is only printed to the console, since it can leak details of
+// the database
+var errInternal = errors.New("something went wrong, please try again later")
+
+// decodeJSON decodes the JSON value read from `body` into `v`.
+// `json.Decoder` stops after the first value, so a body like
+// `{"species":"a"}{"species":"b"}` would silently be taken as the first bird
+// only. Unless trailing data is allowed in the configuration, we reject it
+// instead, and handlers should answer with a 400
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if !config.AllowTrailingJSON && decoder.More() {
+		return errTrailingJSON
+	}
+	return nil
+}
+
+// jsonContentType is the Content-Type of our JSON responses. It advertises
+// that they are UTF-8, unless the charset is turned off in the configuration
+// for clients that can't handle the parameter
+func jsonContentType() string {
+	if config.JSONCharset {
+		return "application/json; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// acceptsJSON tells if the client asked for a JSON response in the `Accept`
+// header, rather than the HTML pages that browsers ask for
+func acceptsJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsMediaType tells if `mediaType` is one of the types accepted by the
+// `Accept` header, directly or through a wildcard such as `application/*`. A
+// missing header accepts anything
+func acceptsMediaType(accept, mediaType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	group := strings.SplitN(mediaType, "/", 2)[0] + "/*"
+	for _, accepted := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		// `q=0` means that the type is not acceptable at all
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		if t == "*/*" || t == group || t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedMediaTypes are the types that the JSON endpoints can respond with
+var supportedMediaTypes = []string{"application/json"}
+
+// acceptJSONMiddleware turns away the clients that can't take JSON, with a
+// 406 Not Acceptable listing the types we do produce, when the configuration
+// is strict about it. Otherwise they get JSON anyway
+func acceptJSONMiddleware(next http.Handler) http.Handler {
+	return acceptMiddleware(supportedMediaTypes, next)
+}
+
+// acceptMiddleware is `acceptJSONMiddleware` for the endpoints that can
+// respond with any of the `supported` media types
+func acceptMiddleware(supported []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.StrictAccept && !acceptsAnyMediaType(r.Header.Get("Accept"), supported) {
+			w.Header().Set("Content-Type", jsonContentType())
+			w.WriteHeader(http.StatusNotAcceptable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     "responses are only available as " + strings.Join(supported, ", "),
+				"supported": supported,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsAnyMediaType tells if the `Accept` header accepts one of `mediaTypes`
+func acceptsAnyMediaType(accept string, mediaTypes []string) bool {
+	for _, mediaType := range mediaTypes {
+		if acceptsMediaType(accept, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes `v` as the JSON body of a successful response. If it can't
+// be converted to JSON, the error is printed to the console, and the client
+// gets a server error instead
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType())
+	w.Write(body)
+}
+
+// marshalBirds writes `data` as the JSON body of a successful response, like
+// `writeJSON`. With `pretty`, it is indented by two spaces, for the people
+// reading the responses while debugging
+func marshalBirds(w http.ResponseWriter, data interface{}, pretty bool) {
+	if !pretty {
+		writeJSON(w, data)
+		return
+	}
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType())
+	w.Write(append(body, '\n'))
+}
+
+// wantsPretty tells whether the client asked for indented JSON, with
+// `?pretty=true` or the `X-Pretty: true` header
+func wantsPretty(r *http.Request) bool {
+	return r.URL.Query().Get("pretty") == "true" || r.Header.Get("X-Pretty") == "true"
+}
+
+// writeJSONError responds with the `status` code, and `msg` as a JSON error
+// body, as in `{"error": "species is required"}`
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", jsonContentType())
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
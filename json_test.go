@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeJSONTrailingData(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+
+	body := `{"species":"a"}{"species":"b"}`
+
+	bird := Bird{}
+	if err := decodeJSON(strings.NewReader(body), &bird); err != errTrailingJSON {
+		t.Errorf("two concatenated objects should be rejected, got error %v", err)
+	}
+
+	// A single object, even followed by whitespace, is fine
+	bird = Bird{}
+	if err := decodeJSON(strings.NewReader(`{"species":"a"}`+"\n"), &bird); err != nil || bird.Species != "a" {
+		t.Errorf("single object should be decoded, got %+v, error %v", bird, err)
+	}
+
+	// Trailing data is ignored when it is allowed
+	config.AllowTrailingJSON = true
+	bird = Bird{}
+	if err := decodeJSON(strings.NewReader(body), &bird); err != nil || bird.Species != "a" {
+		t.Errorf("first object should be decoded, got %+v, error %v", bird, err)
+	}
+}
+
+func TestWriteJSONContentType(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+
+	tests := []struct {
+		charset             bool
+		expectedContentType string
+	}{
+		{true, "application/json; charset=utf-8"},
+		{false, "application/json"},
+	}
+
+	for _, tt := range tests {
+		config.JSONCharset = tt.charset
+		recorder := httptest.NewRecorder()
+		writeJSON(recorder, []*Bird{})
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+			t.Errorf("charset %v: wrong content type: got %q want %q", tt.charset, contentType, tt.expectedContentType)
+		}
+		if body := recorder.Body.String(); body != "[]" {
+			t.Errorf("wrong body: got %q want %q", body, "[]")
+		}
+	}
+}
+
+// TestJSONResponsesStartWithValue guards against anything being written
+// before the JSON value, such as a byte order mark, which strict clients
+// refuse. The list goes through the middlewares that `main` puts in front of
+// the router, since those are the most likely to wrap the response
+func TestJSONResponsesStartWithValue(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil)
+
+	r := newRouter(srv)
+	r.Use(func(next http.Handler) http.Handler {
+		return slowRequestMiddleware(time.Hour, next)
+	})
+	var h http.Handler = optionsMiddleware(r, r)
+	h = hstsMiddleware(60, true, h)
+	h = maxQueryParamsMiddleware(50, h)
+	h = acceptCharsetMiddleware(h)
+	h = requestIDMiddleware("X-Request-ID", h)
+
+	for _, rootObject := range []bool{false, true} {
+		config.ListRootObject = rootObject
+		for _, url := range []string{"/bird", "/bird?as=map", "/bird?as=unknown"} {
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+
+			body := recorder.Body.String()
+			if strings.HasPrefix(body, "\uFEFF") {
+				t.Errorf("%s: the body starts with a byte order mark", url)
+			}
+			if body == "" || (body[0] != '[' && body[0] != '{') {
+				t.Errorf("%s: the body should start with [ or {, got %q", url, body)
+			}
+		}
+	}
+}
+
+func TestMarshalBirds(t *testing.T) {
+	birds := []*Bird{{ID: 1, Species: "sparrow"}}
+
+	compact := httptest.NewRecorder()
+	marshalBirds(compact, birds, false)
+	if body := compact.Body.String(); strings.Contains(body, "\n") || !strings.HasPrefix(body, `[{"id":1,"species":"sparrow"`) {
+		t.Errorf("expected compact JSON, got %q", body)
+	}
+
+	indented := httptest.NewRecorder()
+	marshalBirds(indented, birds, true)
+	if body := indented.Body.String(); !strings.HasPrefix(body, "[\n  {\n    \"id\": 1,\n    \"species\": \"sparrow\",") {
+		t.Errorf("expected JSON indented by two spaces, got %q", body)
+	}
+	if contentType := indented.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("wrong content type: %q", contentType)
+	}
+
+	// Both are the same data
+	var fromCompact, fromIndented []Bird
+	if err := json.Unmarshal(compact.Body.Bytes(), &fromCompact); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(indented.Body.Bytes(), &fromIndented); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromCompact, fromIndented) {
+		t.Errorf("the indented JSON should hold the same birds, got %v and %v", fromCompact, fromIndented)
+	}
+}
+
+func TestPrettyBirdHandlers(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil)
+	mockStore.On("GetBirdByID", 1).Return(&Bird{ID: 1, Species: "sparrow"}, nil)
+	mockStore.On("IncrementViews", 1).Return(nil)
+	router := newRouter(srv)
+
+	tests := []struct {
+		name           string
+		path           string
+		header         string
+		expectedPrefix string
+	}{
+		{"list", "/bird", "", `[{"id":1,`},
+		{"pretty list", "/bird?pretty=true", "", "[\n  {\n    \"id\": 1,"},
+		{"pretty list header", "/bird", "true", "[\n  {\n    \"id\": 1,"},
+		{"bird", "/bird/1", "", `{"id":1,`},
+		{"pretty bird", "/bird/1?pretty=true", "", "{\n  \"id\": 1,"},
+		{"pretty bird header", "/bird/1", "true", "{\n  \"id\": 1,"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("X-Pretty", tt.header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, recorder.Code, http.StatusOK)
+		}
+		if body := recorder.Body.String(); !strings.HasPrefix(body, tt.expectedPrefix) {
+			t.Errorf("%s: expected the body to start with %q, got %q", tt.name, tt.expectedPrefix, body)
+		}
+	}
+}
+
+func TestAcceptJSONMiddleware(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	r := newRouter(srv)
+
+	tests := []struct {
+		strict         bool
+		accept         string
+		expectedStatus int
+	}{
+		{true, "application/pdf", http.StatusNotAcceptable},
+		{true, "application/json, application/pdf;q=0.5", http.StatusOK},
+		{true, "application/*", http.StatusOK},
+		{true, "*/*", http.StatusOK},
+		{true, "", http.StatusOK},
+		{true, "application/json;q=0, */*", http.StatusOK},
+		{true, "application/json;q=0", http.StatusNotAcceptable},
+		{true, "application/xml", http.StatusOK},
+		// Clients get JSON anyway, unless the configuration is strict
+		{false, "application/pdf", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		config.StrictAccept = tt.strict
+		req, err := http.NewRequest("GET", "/bird", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", tt.accept)
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("Accept %q (strict %v): wrong status code: got %v want %v", tt.accept, tt.strict, status, tt.expectedStatus)
+		}
+		if recorder.Code != http.StatusNotAcceptable {
+			continue
+		}
+		body := struct {
+			Supported []string `json:"supported"`
+		}{}
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		// GET /bird can also respond with XML
+		if !reflect.DeepEqual(body.Supported, birdMediaTypes) {
+			t.Errorf("Accept %q: the supported types should be listed, got %v", tt.accept, body.Supported)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"net"
+)
+
+// listen opens the TCP listener of the server on `addr`. When `backlog` is
+// above 0, it replaces the length of the queue of connections that the kernel
+// has accepted but the server hasn't picked up yet, which otherwise defaults
+// to the system maximum on Linux.
+//
+// The kernel has the last word on the backlog: Linux silently caps it at
+// `net.core.somaxconn`, and macOS and the BSDs at `kern.ipc.somaxconn`, so
+// those need raising for a larger value to have any effect. It can't be set
+// at all on Windows, where `listen` fails when a backlog is configured
+func listen(ctx context.Context, addr string, backlog int) (net.Listener, error) {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil || backlog <= 0 {
+		return ln, err
+	}
+	if err := setBacklog(ln.(*net.TCPListener), backlog); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
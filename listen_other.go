@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func setBacklog(ln *net.TCPListener, backlog int) error {
+	return errors.New("LISTEN_BACKLOG is not supported on this platform")
+}
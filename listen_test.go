@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestListenWithBacklog(t *testing.T) {
+	ln, err := listen(context.Background(), "127.0.0.1:0", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(handler)}
+	go server.Serve(ln)
+	defer server.Close()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "Hello World!" {
+		t.Errorf("unexpected response from the server: %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setBacklog calls `listen` again on the socket, which keeps it listening and
+// only changes the length of its queue
+func setBacklog(ln *net.TCPListener, backlog int) error {
+	raw, err := ln.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	if listenErr != nil {
+		return fmt.Errorf("setting the listen backlog: %w", listenErr)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// statusRecorder remembers the status code of the response written through
+// it. Handlers that never call `WriteHeader` respond with 200 OK
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap gives `http.ResponseController` access to the underlying writer, to
+// flush it for instance
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logValue makes `s`, which comes from the client, safe to log as the value of
+// a field. The path of a request is decoded, so it can hold a newline that
+// would start a forged log line, or a space that would add a field. Values
+// like these are quoted, with their control characters escaped, and the rest
+// are logged as they are
+func logValue(s string) string {
+	if strings.IndexFunc(s, func(r rune) bool { return r == ' ' || r == '"' || !unicode.IsPrint(r) }) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// loggingMiddleware logs every request once it has been served, with its
+// method, path, response status, how long it took and the client it came
+// from (see `ClientIP`), as in
+// `method=GET path=/bird status=200 duration=1.2ms client_ip=203.0.113.7 request_id=...`,
+// when the request was given an ID. Paths that could forge log lines are
+// quoted (see `logValue`). The request is also counted in the metrics
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+		line := fmt.Sprintf("method=%s path=%s status=%d duration=%v client_ip=%s", r.Method, logValue(r.URL.Path), rec.status, duration, ClientIP(r))
+		if id := requestIDFromContext(r.Context()); id != "" {
+			line += " request_id=" + id
+		}
+		log.Print(line)
+		observeRequest(r.Method, rec.status, duration)
+	})
+}
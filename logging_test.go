@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	hf := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	req, err := http.NewRequest("POST", "/bird", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+
+	// The status given by the handler should still reach the client...
+	if status := recorder.Code; status != http.StatusTeapot {
+		t.Errorf("wrong status code: got %v want %v", status, http.StatusTeapot)
+	}
+
+	// ...and be logged, along with how long the request took
+	var method, path, duration string
+	var status int
+	if _, err := fmt.Sscanf(logs.String(), "method=%s path=%s status=%d duration=%s", &method, &path, &status, &duration); err != nil {
+		t.Fatalf("unexpected log line %q: %v", logs.String(), err)
+	}
+	if method != "POST" || path != "/bird" || status != http.StatusTeapot {
+		t.Errorf("wrong request logged: %q", logs.String())
+	}
+	if d, err := time.ParseDuration(duration); err != nil || d <= 0 {
+		t.Errorf("expected a duration, got %q", duration)
+	}
+}
+
+func TestLoggingMiddlewareClientIP(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	trusted, err := parseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(old Config) { config = old }(config)
+	config.TrustedProxies = trusted
+
+	hf := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name       string
+		remoteAddr string
+		expectedIP string
+	}{
+		// The client behind a trusted proxy is logged...
+		{"trusted proxy", "10.1.2.3:80", "198.51.100.1"},
+		// ...but anyone else can't choose the address they are logged with
+		{"untrusted peer", "203.0.113.7:5123", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/bird", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		hf.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !strings.Contains(logs.String(), " client_ip="+tt.expectedIP+"\n") {
+			t.Errorf("%s: expected client_ip=%s to be logged, got %q", tt.name, tt.expectedIP, logs.String())
+		}
+	}
+}
+
+func TestLoggingMiddlewareForgedPath(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	hf := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// The path is decoded, so it holds a newline and spaces
+	req := httptest.NewRequest("GET", "/bird%0A2020/01/01%2000:00:00%20method=DELETE%20path=/bird", nil)
+	hf.ServeHTTP(httptest.NewRecorder(), req)
+
+	if lines := strings.Count(logs.String(), "\n"); lines != 1 {
+		t.Errorf("expected a single log line, got %d: %q", lines, logs.String())
+	}
+	expected := `path="/bird\n2020/01/01 00:00:00 method=DELETE path=/bird" status=200`
+	if !strings.Contains(logs.String(), expected) {
+		t.Errorf("expected the path to be quoted, got %q", logs.String())
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	tests := []struct {
+		value, expected string
+	}{
+		{"/bird/1", "/bird/1"},
+		{"/bird/{id}", "/bird/{id}"},
+		{"/birds/é", "/birds/é"},
+		{"/bird\r\nmethod=DELETE", `"/bird\r\nmethod=DELETE"`},
+		{"/bird status=500", `"/bird status=500"`},
+		{`/bird"`, `"/bird\""`},
+		{"/bird\t1", `"/bird\t1"`},
+	}
+
+	for _, tt := range tests {
+		if got := logValue(tt.value); got != tt.expected {
+			t.Errorf("logValue(%q) = %s, want %s", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -2,18 +2,37 @@ package main
 
 import (
 	// Import the gorilla/mux library we just installed
+	"context"
 	"database/sql"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/skip2/go-qrcode"
 )
 
 // The new router function creates the router and
 // returns it to us. We can now use this function
-// to instantiate and test the router outside of the main function
-func newRouter() *mux.Router {
+// to instantiate and test the router outside of the main function.
+// The handlers of the router work with the store of `s`
+func newRouter(s *Server) *mux.Router {
 	// Declare a new router
 	r := mux.NewRouter()
 
@@ -21,10 +40,11 @@ func newRouter() *mux.Router {
 	// this path will be valid for
 	// Define Route: `GET /hello`
 	r.HandleFunc("/hello", handler).Methods("GET")
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
 
 	// Declare the static file directory and point it to the
-	// directory we just made
-	staticFileDirectory := http.Dir("./assets/")
+	// directory we just made, or the one given with `-assets`
+	staticFileDirectory := http.Dir(config.AssetDir)
 	// Declare the handler, that routes requests to their respective filename.
 	// The fileserver is wrapped in the `stripPrefix` method, because we want to
 	// remove the "/assets/" prefix when looking for files.
@@ -38,19 +58,306 @@ func newRouter() *mux.Router {
 	r.PathPrefix("/assets/").Handler(staticFileHandler).Methods("GET")
 
 	// These lines are added inside the newRouter() function before returning r
-	r.HandleFunc("/bird", getBirdHandler).Methods("GET")
-	r.HandleFunc("/bird", createBirdHandler).Methods("POST")
+	// The bird API handlers negotiate the version of their payloads with the client
+	r.Handle("/bird", apiVersionMiddleware(acceptMiddleware(birdMediaTypes, etagMiddleware(http.HandlerFunc(s.getBirdHandler))))).Methods("GET")
+	r.Handle("/bird", apiVersionMiddleware(http.HandlerFunc(s.countBirdsHandler))).Methods("HEAD")
+
+	// The routes that change birds are grouped, so that they can be guarded
+	// by the API key, while reading stays public. Their bodies are capped by
+	// `bodyLimitMiddleware`, once the key has been checked
+	writes := r.MatcherFunc(isWriteRequest).Subrouter()
+	writes.Use(authMiddleware, bodyLimitMiddleware)
+	writes.Handle("/bird", apiVersionMiddleware(bodyTimeoutMiddleware(http.HandlerFunc(s.createBirdHandler)))).Methods("POST")
+	writes.Handle("/birds", apiVersionMiddleware(bodyTimeoutMiddleware(http.HandlerFunc(s.createBirdsHandler)))).Methods("POST")
+	writes.HandleFunc("/bird/{id}", s.updateBirdHandler).Methods("PUT")
+	writes.HandleFunc("/bird/{id}", s.patchBirdHandler).Methods("PATCH")
+	writes.HandleFunc("/bird/{id}", s.deleteBirdHandler).Methods("DELETE")
+
+	// Registered before `/bird/{id}`, which would take them as IDs
+	r.HandleFunc("/bird/first", s.getFirstBirdHandler).Methods("GET")
+	r.HandleFunc("/bird/count", s.getBirdCountHandler).Methods("GET")
+	r.HandleFunc("/bird/export", s.exportBirdsCSVHandler).Methods("GET")
+	r.HandleFunc("/bird/species", s.getSpeciesCountsHandler).Methods("GET")
+	r.Handle("/bird/{id}", acceptMiddleware(birdMediaTypes, http.HandlerFunc(s.getBirdByIDHandler))).Methods("GET")
+	r.HandleFunc("/bird/{id}/qr", s.getBirdQRHandler).Methods("GET")
+	r.HandleFunc("/birds/bounds", s.getBirdBoundsHandler).Methods("GET")
+	r.HandleFunc("/birds/stats/daily", s.getDailyStatsHandler).Methods("GET")
+	r.Handle("/birds/letter/{c}", acceptJSONMiddleware(http.HandlerFunc(s.getBirdsByLetterHandler))).Methods("GET")
+	r.HandleFunc("/birds/initials", s.getSpeciesInitialsHandler).Methods("GET")
+	r.Handle("/birds/grouped", acceptJSONMiddleware(http.HandlerFunc(s.getBirdsGroupedHandler))).Methods("GET")
+	r.Handle("/birds/top", acceptJSONMiddleware(http.HandlerFunc(s.getTopBirdsHandler))).Methods("GET")
+	r.Handle("/birds/recently-updated", acceptJSONMiddleware(http.HandlerFunc(s.getRecentlyUpdatedHandler))).Methods("GET")
+	r.Handle("/birds/incomplete", acceptJSONMiddleware(http.HandlerFunc(s.getIncompleteBirdsHandler))).Methods("GET")
+	r.HandleFunc("/birds/checksum", s.getChecksumHandler).Methods("GET")
+	r.HandleFunc("/birds/max-id", s.getMaxBirdIDHandler).Methods("GET")
+	r.Handle("/birds/stale", acceptJSONMiddleware(http.HandlerFunc(s.getStaleBirdsHandler))).Methods("GET")
+	r.HandleFunc("/birds/backup.zip", s.backupHandler).Methods("GET")
+	r.HandleFunc("/birds/export", s.exportBirdsHandler).Methods("GET")
+	r.HandleFunc("/birds.rss", s.feedHandler).Methods("GET")
+
+	// Health checks and admin endpoints used when operating the service
+	r.HandleFunc("/healthz", s.healthzHandler).Methods("GET")
+	r.HandleFunc("/version", versionHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/readyz", s.readyzHandler).Methods("GET")
+	r.Handle("/admin/drain", adminMiddleware(http.HandlerFunc(drainHandler))).Methods("POST")
+	r.Handle("/admin/descriptions/replace", adminMiddleware(bodyLimitMiddleware(http.HandlerFunc(s.replaceDescriptionHandler)))).Methods("POST")
+	r.Handle("/admin/schema-version", adminMiddleware(http.HandlerFunc(s.schemaVersionHandler))).Methods("GET")
+	r.Handle("/admin/birds", adminMiddleware(http.HandlerFunc(s.deleteBirdsMatchingHandler))).Methods("DELETE")
+	// Deleting every bird is an admin operation, even though it isn't under
+	// /admin/, as it would take a single request to lose all of them
+	r.Handle("/bird", adminMiddleware(http.HandlerFunc(s.deleteAllBirdsHandler))).Methods("DELETE")
 	return r
 }
 
 func main() {
+	addr := flag.String("addr", defaultAddr, "address to listen on, such as :8080 (defaults to :$PORT when PORT is set)")
+	assetDir := flag.String("assets", defaultAssetDir, "directory of the static files served under /assets/")
+	readTimeout := flag.Duration("read-timeout", defaultServerTimeouts.Read, "how long clients have to send a request")
+	writeTimeout := flag.Duration("write-timeout", defaultServerTimeouts.Write, "how long the server has to send a response")
+	idleTimeout := flag.Duration("idle-timeout", defaultServerTimeouts.Idle, "how long kept-alive connections wait for their next request")
+	tlsCert := flag.String("tls-cert", "", "certificate file, to serve over HTTPS along with -tls-key")
+	tlsKey := flag.String("tls-key", "", "private key file of the -tls-cert certificate")
+	seed := flag.Bool("seed", false, "create sample birds on startup, when there are none")
+	cacheTTL := flag.Duration("cache-ttl", 0, "how long the list of birds read from the database is cached, such as 5s (not cached when 0)")
+	flag.Parse()
+	addrSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" {
+			addrSet = true
+		}
+	})
+
+	// Load the settings that operators can change from the environment
+	cfg, err := loadConfig(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config = cfg
+	config.AssetDir = *assetDir
+	if config.APIKey == "" {
+		log.Println("WARN API_KEY is not set, so anyone can create, change and delete birds")
+	}
+	serveTLS, err := useTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// The router is now formed by calling the `newRouter` constructor function
-	// that we defined above. The rest of the code stays the same
-	r := newRouter()
-	// We can then pass our router (after declaring all our routes) to this method
-	// (where previously, we were leaving the second argument as nil)
-	http.ListenAndServe(":8080", r)
+	// that we defined above. The server gets its store once it is listening
+	// (see below), and the readiness gate holds requests back until then
+	srv := newServer(nil)
+	r := newRouter(srv)
+	if err := validateRoutes(r); err != nil {
+		log.Fatal(err)
+	}
+	var h http.Handler = r
+
+	// Clients that accept gzip get their responses compressed. This comes
+	// first, so that the middlewares below see the bodies as they are
+	h = gzipMiddleware(h)
+
+	// Expensive endpoints can be limited to fewer requests at once than the
+	// rest of the API
+	if len(config.RouteConcurrency) > 0 {
+		r.Use(newRouteLimiter(config.RouteConcurrency).middleware)
+	}
+
+	// Operators can tell clients and caches how long responses can be kept
+	if len(config.CacheControl) > 0 {
+		r.Use(cacheControlMiddleware(config.CacheControl))
+	}
+
+	// Requests that take too long are logged, to keep an eye on latency
+	if config.SlowRequestThreshold > 0 {
+		r.Use(func(next http.Handler) http.Handler {
+			return slowRequestMiddleware(config.SlowRequestThreshold, next)
+		})
+	}
+
+	// API discovery tools can ask any path which methods it supports
+	if config.AnswerOptions {
+		h = optionsMiddleware(r, h)
+	}
+
+	// Pages from another origin can call the API from the browser. This comes
+	// in front of the `OPTIONS` answers, so that preflight requests get CORS headers
+	if config.CORSOrigin != "" {
+		h = corsMiddleware(config.CORSOrigin, r, h)
+	}
+
+	// When debugging, every request can be recorded so that it can be replayed
+	if config.CaptureFile != "" {
+		capture, err := newRequestCapture(config.CaptureFile, config.CaptureMaxBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer capture.Close()
+		h = capture.middleware(h)
+	}
+
+	// In debug mode, the bodies of the chosen routes are logged, to see what
+	// clients actually send and get
+	if config.Debug && len(config.BodyLogRoutes) > 0 {
+		h = bodyLogMiddleware(config.BodyLogRoutes, config.BodyLogMaxBytes, h)
+	}
+
+	// HTTPS deployments keep browsers from ever falling back to plain HTTP
+	if config.HSTSMaxAge > 0 {
+		h = hstsMiddleware(config.HSTSMaxAge, config.HSTSIncludeSubdomains, h)
+	}
+
+	// Requests for other hostnames are sent over to the canonical one
+	if config.CanonicalHost != "" {
+		h = canonicalHostMiddleware(config.CanonicalHost, h)
+	}
+
+	// A client that sends too many requests is told to slow down, before they
+	// cost us anything
+	if config.RateLimit > 0 {
+		h = rateLimitMiddleware(config.RateLimit, config.RateLimitBurst, h)
+	}
+
+	// Requests with an abusive number of query parameters are turned away
+	// before any handler parses them
+	if config.MaxQueryParams > 0 {
+		h = maxQueryParamsMiddleware(config.MaxQueryParams, h)
+	}
+
+	// Strict clients can be told upfront that we only respond in UTF-8
+	if config.EnforceAcceptCharset {
+		h = acceptCharsetMiddleware(h)
+	}
+
+	// Clients that can only send GET and POST can still call the other methods
+	if config.MethodOverride {
+		h = methodOverrideMiddleware(h)
+	}
+
+	// A handler that panics fails its own request with a 500, rather than the
+	// whole server. It sits inside the logging, so that the 500 is logged too
+	h = recoverMiddleware(h)
+
+	// Every request is logged, with its status and how long it took
+	h = loggingMiddleware(h)
+
+	// Every request gets an ID, to follow it through the logs of the services
+	// it goes through. It is set first, so that even the requests turned away
+	// by the middlewares above have one
+	h = requestIDMiddleware(config.RequestIDHeader, h)
+
+	// Recurring maintenance tasks are registered with the scheduler, which
+	// runs them in the background until the server exits
+	sched := newScheduler()
+	sched.Start()
+	defer sched.Stop()
+
+	// We can then pass our router (after declaring all our routes) to the
+	// server (where previously, we were leaving the handler as nil)
+	h = readinessMiddleware(h)
+	if config.H2C {
+		h = h2cMiddleware(h)
+	}
+	server := newHTTPServer(resolveAddr(*addr, addrSet, os.Getenv), h, serverTimeouts{
+		Read:  *readTimeout,
+		Write: *writeTimeout,
+		Idle:  *idleTimeout,
+	})
+
+	// A single client can only keep so many connections open at once
+	if config.MaxConnsPerIP > 0 {
+		server.ConnState = newConnLimiter(config.MaxConnsPerIP).ConnState
+	}
+	ln, err := listen(context.Background(), server.Addr, config.ListenBacklog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The server runs in the background, so that we can wait for the signal
+	// to stop it
+	serveErr := make(chan error, 1)
+	go func() {
+		if serveTLS {
+			log.Println("listening with TLS on", server.Addr)
+			serveErr <- server.ServeTLS(ln, *tlsCert, *tlsKey)
+			return
+		}
+		log.Println("listening on", server.Addr)
+		serveErr <- server.Serve(ln)
+	}()
+
+	// Connecting to the database and seeding it can take a while. It is done
+	// now that the server is listening, so that the health checks are
+	// answered in the meantime, while other requests get a 503 from the
+	// readiness gate until the store is ready
+	storeErr := make(chan error, 1)
+	go func() {
+		store, err := initStore(context.Background(), config.DatabaseURL, *cacheTTL, *seed)
+		if err != nil {
+			storeErr <- err
+			return
+		}
+		srv.store = store
+		setReady(true)
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case err := <-storeErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Println("received", sig, "shutting down")
+	}
+
+	// Stop accepting connections, and give the requests in flight some time
+	// to finish, so that clients aren't cut off in the middle of a response.
+	// The load balancer is told that we are going away in the meantime
+	draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("shutdown timed out, closing the remaining connections:", err)
+		server.Close()
+		return
+	}
+	log.Println("shutdown complete")
+}
+
+// initStore connects to the database, when there is one. Without it the birds
+// are kept in memory, and are lost when the server stops. The store is seeded
+// with sample birds when `seed` is set
+func initStore(ctx context.Context, databaseURL string, cacheTTL time.Duration, seed bool) (Store, error) {
+	var store Store
+	if databaseURL == "" {
+		log.Println("DATABASE_URL is not set, keeping the birds in memory")
+		store = newMemStore()
+	} else {
+		db, err := openDBStore(databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSchemaVersion(ctx, db); err != nil {
+			return nil, err
+		}
+		store = db
+		// Read-heavy deployments can spare the database from listing every
+		// bird on each request
+		if cacheTTL > 0 {
+			store = newCachingStore(db, cacheTTL)
+		}
+	}
+
+	// Demos and local development can start with some sample birds
+	if seed {
+		seeded, err := seedBirds(ctx, store)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("seeded %d sample birds", seeded)
+	}
+	return store, nil
 }
 
 // Handler functions are responsible for exposing the business logic i.e.
@@ -60,134 +367,1844 @@ func handler(w http.ResponseWriter, r *http.Request) {
 }
 
 type Bird struct {
-	Species     string `json:"species"`
-	Description string `json:"description"`
+	XMLName     xml.Name  `json:"-" xml:"bird"`
+	ID          int       `json:"id" xml:"id"`
+	Species     string    `json:"species" xml:"species" validate:"required,notblank,max=100"`
+	Description string    `json:"description" xml:"description" validate:"maxdescription"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" xml:"updated_at"`
+	// Version starts at 1, and goes up with every change to the bird, so
+	// that clients can tell whether the bird they edit is still the latest
+	Version int `json:"version" xml:"version"`
+}
+
+// maxSpeciesLength is the longest species name that a bird can have. Tags
+// can't refer to constants, so it is repeated in the one of `Bird.Species`
+const maxSpeciesLength = 100
+
+// normalize cleans up the whitespace that clients leave around the species
+// and description, as in " Robin ". With `collapse`, the runs of whitespace
+// inside them are also turned into single spaces
+func (b *Bird) normalize(collapse bool) {
+	for _, field := range []*string{&b.Species, &b.Description} {
+		normalizeField(field, collapse)
+	}
+}
+
+// normalizeField cleans up the whitespace of a single field, like `normalize`
+func normalizeField(field *string, collapse bool) {
+	if collapse {
+		*field = strings.Join(strings.Fields(*field), " ")
+	} else {
+		*field = strings.TrimSpace(*field)
+	}
 }
 
-var birds []Bird
+// validate checks a bird before it is stored, against the rules of its
+// `validate` tags, and returns ValidationErrors listing the broken ones. The
+// description limit is also enforced by the database (see schema.go), so that
+// the two can't drift apart
+func (b *Bird) validate() error {
+	return validatePayload(b)
+}
+
+func (s *Server) getBirdHandler(w http.ResponseWriter, r *http.Request) {
+	// Without a store there is nothing to list. This is a bug in how the
+	// application was started, rather than something the client did
+	if s.store == nil {
+		fmt.Println(fmt.Errorf("Error: %v", errNoStore))
+		writeJSONError(w, http.StatusInternalServerError, errNoStore.Error())
+		return
+	}
+	// The list can be sent as XML, or indented, so caches must keep them apart
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "X-Pretty")
+
+	// Faceted search UIs ask for a page of the matching birds, along with
+	// counts over all of them
+	if r.URL.Query().Get("facets") != "" {
+		s.writeFacetedPage(w, r)
+		return
+	}
+
+	// Sync clients pass the `updated_at` of the newest bird they have seen, and
+	// only want the birds that changed after it
+	if since := r.URL.Query().Get("modified_since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "modified_since must be an RFC 3339 timestamp")
+			return
+		}
+		modified, err := s.store.BirdsModifiedSince(r.Context(), t)
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+		writeFilteredBirds(w, r, modified)
+		return
+	}
+
+	// Full text search matches the words of the description, so that a
+	// search for "fly" also finds birds that are "flying"
+	if query := r.URL.Query().Get("fts"); query != "" {
+		matches, err := s.store.FullTextSearch(r.Context(), query)
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+		writeFilteredBirds(w, r, matches)
+		return
+	}
+
+	// A keyword searches the descriptions, as in `?q=prey`, and can be
+	// combined with a part of the species, as in `?q=prey&species=eagle`
+	if keyword := r.URL.Query().Get("q"); keyword != "" {
+		matches, err := s.store.SearchBirds(r.Context(), r.URL.Query().Get("species"), keyword)
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+		writeFilteredBirds(w, r, matches)
+		return
+	}
+
+	// Several species, as in `?species=robin&species=eagle` or
+	// `?species=robin,eagle`, select the birds of exactly those species, for
+	// the filter chips of the UI
+	if species := speciesList(r.URL.Query()["species"]); len(species) > 1 {
+		matches, err := s.store.BirdsBySpeciesList(r.Context(), species)
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+		writeFilteredBirds(w, r, matches)
+		return
+	}
+
+	// Users can look birds up by a part of their species, whatever the case
+	if species := r.URL.Query().Get("species"); species != "" {
+		matches, err := s.store.FindBirdsBySpecies(r.Context(), species)
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+		writeFilteredBirds(w, r, matches)
+		return
+	}
+
+	// Data quality tools look for stubs, and other suspicious descriptions,
+	// by their length
+	if r.URL.Query().Get("min_description_length") != "" || r.URL.Query().Get("max_description_length") != "" {
+		s.writeBirdsByDescriptionLength(w, r)
+		return
+	}
+
+	// Clients that ask for a page of birds get it in a `Page` envelope, which
+	// tells them whether there are more to fetch
+	if r.URL.Query().Get("limit") != "" || r.URL.Query().Get("offset") != "" {
+		s.writeBirdsPage(w, r)
+		return
+	}
 
-func getBirdHandler(w http.ResponseWriter, r *http.Request) {
-	// To test the GET call set birds to some initial value
-	birds = []Bird{{"Chimni", "Found in India"}}
 	/*
 		The list of birds is now taken from the store instead of the package level  `birds` variable we had earlier
-		The `store` variable is the package level variable that we defined in
-		`store.go`, and is initialized during the initialization phase of the
-		application
+		The store is the one the server was created with, when the
+		application started
 	*/
-	// birds, err := store.GetBirds()
-
-	//Convert the "birds" variable to json
-	birdListBytes, err := json.Marshal(birds)
+	birds, err := s.store.GetBirds(r.Context())
 
 	// If there is an error, print it to the console, and return a server
-	// error response to the user
+	// error response to the user. During a database outage, the last list we
+	// read can be served instead, flagged as stale, if it is enabled
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		if stale, ok := s.lastBirds.get(); ok && config.ServeStale {
+			w.Header().Set("X-Served-Stale", "true")
+			writeFilteredBirds(w, r, stale)
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	if config.ServeStale {
+		s.lastBirds.set(birds)
+	}
+	// Convert the birds to json, and write them to the response
+	writeFilteredBirds(w, r, birds)
+}
+
+// speciesList reads the species of the repeated `species` query parameters,
+// each of which can also be a comma separated list
+func speciesList(values []string) []string {
+	species := []string{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				species = append(species, name)
+			}
+		}
+	}
+	return species
+}
+
+// countBirdsHandler answers `HEAD /bird` with the number of birds in the
+// `X-Total-Count` header, for clients that only want to know how many birds
+// there are without fetching them all
+func (s *Server) countBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := s.store.CountBirds(r.Context())
 	if err != nil {
 		fmt.Println(fmt.Errorf("Error: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
 		return
 	}
-	// If all goes well, write the JSON list of birds to the response
-	w.Write(birdListBytes)
+	w.Header().Set("X-Total-Count", strconv.Itoa(count))
+	w.WriteHeader(http.StatusOK)
 }
 
-func createBirdHandler(w http.ResponseWriter, r *http.Request) {
-	// Create a new instance of Bird
-	bird := Bird{}
+// writeBirdsByDescriptionLength responds with the birds whose description
+// length is between the `min_description_length` (0 by default) and
+// `max_description_length` (the longest allowed by default) query parameters
+func (s *Server) writeBirdsByDescriptionLength(w http.ResponseWriter, r *http.Request) {
+	min, max := 0, config.MaxDescriptionLength
+	for param, n := range map[string]*int{"min_description_length": &min, "max_description_length": &max} {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		var err error
+		if *n, err = strconv.Atoi(v); err != nil || *n < 0 {
+			writeJSONError(w, http.StatusBadRequest, param+" must be a number, and not negative")
+			return
+		}
+	}
+	if min > max {
+		writeJSONError(w, http.StatusBadRequest, "min_description_length can't be more than max_description_length")
+		return
+	}
+
+	birds, err := s.store.BirdsByDescriptionLength(r.Context(), min, max)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeFilteredBirds(w, r, birds)
+}
 
-	// We send all our data as HTML form data
-	// the `ParseForm` method of the request, parses the
-	// form values
-	err := r.ParseForm()
+// defaultPageLimit is the number of birds in a page when the client only
+// gives an `offset`, and maxPageLimit is the most a client can ask for
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// writeBirdsPage responds with the page of birds selected by the `limit` and
+// `offset` query parameters, read by `pageParams`
+func (s *Server) writeBirdsPage(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	// In case of any error, we respond with an error to the user
+	page, err := s.store.GetBirdsPage(r.Context(), limit, offset)
 	if err != nil {
 		fmt.Println(fmt.Errorf("Error: %v", err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	page.setLinks(r.URL)
+	marshalBirds(w, page, wantsPretty(r))
+}
+
+// writeFilteredBirds writes the birds matching a filter. No matches is an
+// empty list by default, but clients that would rather treat it as an error
+// can ask for a 404 with `not_found_on_empty=true`. Clients that look birds up
+// by ID can ask for an object keyed by ID instead of a list with `as=map`
+func writeFilteredBirds(w http.ResponseWriter, r *http.Request, birds []*Bird) {
+	if len(birds) == 0 && r.URL.Query().Get("not_found_on_empty") == "true" {
+		writeJSONError(w, http.StatusNotFound, "no birds match the filter")
 		return
 	}
+	switch as := r.URL.Query().Get("as"); as {
+	case "", "list":
+		if prefersXML(r) {
+			writeXML(w, xmlBirds{Birds: birds})
+			return
+		}
+		// An empty list should still be a JSON array, and not `null`
+		if birds == nil {
+			birds = []*Bird{}
+		}
+		marshalBirds(w, listResponse(birds), wantsPretty(r))
+	case "map":
+		marshalBirds(w, birdsByID(birds), wantsPretty(r))
+	default:
+		writeJSONError(w, http.StatusBadRequest, "as must be list or map")
+	}
+}
+
+// birdsByID keys the birds by their ID, as in `{"1":{...},"2":{...}}`. The
+// keys are strings, since that's all a JSON object can have
+func birdsByID(birds []*Bird) map[string]*Bird {
+	byID := make(map[string]*Bird, len(birds))
+	for _, bird := range birds {
+		byID[strconv.Itoa(bird.ID)] = bird
+	}
+	return byID
+}
+
+// writeBirds writes a list of birds fetched from the store as JSON
+func writeBirds(w http.ResponseWriter, birds []*Bird) {
+	// An empty list should still be a JSON array, and not `null`
+	if birds == nil {
+		birds = []*Bird{}
+	}
+	writeJSON(w, listResponse(birds))
+}
+
+// listResponse shapes the body of a list endpoint. Lists are bare JSON arrays,
+// unless the server is configured to wrap them in an object, as in
+// `{"birds":[...]}`, for clients that refuse top-level arrays
+func listResponse(birds interface{}) interface{} {
+	if config.ListRootObject {
+		return map[string]interface{}{"birds": birds}
+	}
+	return birds
+}
+
+func (s *Server) createBirdHandler(w http.ResponseWriter, r *http.Request) {
+	// Create a new instance of Bird
+	bird := Bird{}
+
+	// API clients send the bird as JSON, while the HTML page sends it as form
+	// data
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := decodeBird(r, &bird); bodyTooLarge(err) {
+			writeBodyTooLarge(w)
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		// We send all our data as HTML form data
+		// the `ParseForm` method of the request, parses the
+		// form values
+		err := r.ParseForm()
+		if bodyTooLarge(err) {
+			writeBodyTooLarge(w)
+			return
+		}
 
-	// Get the information about the bird from the form info
-	bird.Species = r.Form.Get("species")
-	bird.Description = r.Form.Get("description")
+		// In case of any error, we respond with an error to the user
+		if err != nil {
+			fmt.Println(fmt.Errorf("Error: %v", err))
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+			return
+		}
+
+		// Get the information about the bird from the form info
+		bird.Species = r.Form.Get("species")
+		bird.Description = r.Form.Get("description")
+	}
 
-	// Append our existing list of birds with a new entry
-	birds = append(birds, bird)
+	// Make sure the bird can be stored, before we store it
+	bird.normalize(config.CollapseWhitespace)
+	if err := bird.validate(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
 
 	// The only change we made here is to use the `CreateBird` method instead of
 	// appending to the `bird` variable like we did earlier
-	// err = store.CreateBird(&bird)
-	// if err != nil {
-	// 	fmt.Println(err)
-	// }
+	err := s.store.CreateBird(r.Context(), &bird)
+	if isUniqueViolation(err) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("a bird of species %q already exists, update it instead", bird.Species))
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, "the bird could not be saved, please try again later")
+		return
+	}
+
+	// API clients get the bird they created, with the URL it can be found at
+	if acceptsJSON(r) {
+		w.Header().Set("Location", "/bird/"+strconv.Itoa(bird.ID))
+		w.Header().Set("Content-Type", jsonContentType())
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(bird)
+		return
+	}
 
 	//Finally, we redirect the user to the original HTMl page
 	// (located at `/assets/`), using the http libraries `Redirect` method
 	http.Redirect(w, r, "/assets/", http.StatusFound)
 }
 
-// Our store will have two methods, to add a new bird,
-// and to get all existing birds
-// Each method returns an error, in case something goes wrong
-type Store interface {
-	CreateBird(bird *Bird) error
-	GetBirds() ([]*Bird, error)
-}
+// createBirdsHandler creates all the birds of a JSON array at once, as in
+// `[{"species": "eagle"}, {"species": "robin"}]`, and responds with 201 and
+// the created birds. Either all of them are created, or none are
+func (s *Server) createBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	var body []struct {
+		Species     *string `json:"species"`
+		Description string  `json:"description"`
+	}
+	if err := decodeJSON(r.Body, &body); bodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("malformed JSON body: %v", err))
+		return
+	}
+	if len(body) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "at least one bird is required")
+		return
+	}
+
+	// Every bird is checked before any is stored, so that a single bad one
+	// doesn't cost a round trip to the database. The rules broken by all of
+	// them are reported at once, like for a single bird
+	birds := make([]*Bird, len(body))
+	var invalid ValidationErrors
+	for i, b := range body {
+		if b.Species == nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("bird %d: species is required", i))
+			return
+		}
+		birds[i] = &Bird{Species: *b.Species, Description: b.Description}
+		birds[i].normalize(config.CollapseWhitespace)
+		if err := birds[i].validate(); err != nil {
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				writeValidationErrors(w, fmt.Errorf("bird %d: %w", i, err))
+				return
+			}
+			invalid = append(invalid, errs.atIndex(i)...)
+		}
+	}
+	if len(invalid) > 0 {
+		writeValidationErrors(w, invalid)
+		return
+	}
 
-// The store variable is a package level variable that will be available for
-// use throughout our application code
-var store Store
+	if err := s.store.CreateBirds(r.Context(), birds); isUniqueViolation(err) {
+		writeJSONError(w, http.StatusConflict, "some of the species already exist, or are given twice")
+		return
+	} else if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, "the birds could not be saved, please try again later")
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType())
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(birds)
+}
 
-// The `dbStore` struct will implement the `Store` interface
-// It also takes the sql DB connection object, which represents
-// the database connection.
-type dbStore struct {
-	db *sql.DB
+// decodeBird reads the species and description of a bird from a JSON body,
+// such as `{"species": "eagle", "description": "A bird of prey"}`. The
+// species is required
+func decodeBird(r *http.Request, bird *Bird) error {
+	body := struct {
+		Species     *string `json:"species"`
+		Description *string `json:"description"`
+	}{}
+	if err := decodeJSON(r.Body, &body); err != nil {
+		return fmt.Errorf("malformed JSON body: %w", err)
+	}
+	if body.Species == nil {
+		return errors.New("species is required")
+	}
+	bird.Species = *body.Species
+	if body.Description != nil {
+		bird.Description = *body.Description
+	}
+	return nil
 }
 
-func (store *dbStore) CreateBird(bird *Bird) error {
-	// 'Bird' is a simple struct which has "species" and "description" attributes
-	// THe first underscore means that we don't care about what's returned from
-	// this insert query. We just want to know if it was inserted correctly,
-	// and the error will be populated if it wasn't
-	_, err := store.db.Query("INSERT INTO birds(species, description) VALUES ($1,$2)", bird.Species, bird.Description)
-	return err
+// birdID reads the numeric ID of the bird from the `{id}` path variable
+func birdID(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
 }
 
-func (store *dbStore) GetBirds() ([]*Bird, error) {
-	// Query the database for all birds, and return the result to the
-	// `rows` object
-	rows, err := store.db.Query("SELECT species, description from birds")
-	// We return incase of an error, and defer the closing of the row structure
+// getBirdByIDHandler responds with the bird that has the ID `{id}`, as XML
+// for the clients that prefer it, and JSON otherwise
+func (s *Server) getBirdByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := birdID(r)
 	if err != nil {
-		return nil, err
+		writeJSONError(w, http.StatusBadRequest, "the bird ID must be a number")
+		return
 	}
-	defer rows.Close()
 
-	// Create the data structure that is returned from the function.
-	// By default, this will be an empty array of birds
-	birds := []*Bird{}
-	for rows.Next() {
-		// For each row returned by the table, create a pointer to a bird,
-		bird := &Bird{}
-		// Populate the `Species` and `Description` attributes of the bird,
-		// and return incase of an error
-		if err := rows.Scan(&bird.Species, &bird.Description); err != nil {
-			return nil, err
-		}
-		// Finally, append the result to the returned array, and repeat for
-		// the next row
-		birds = append(birds, bird)
+	bird, err := s.store.GetBirdByID(r.Context(), id)
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	// The views tell which birds are popular. Failing to count one is no
+	// reason to keep the bird from the client
+	if err := s.store.IncrementViews(r.Context(), id); err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+	}
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "X-Pretty")
+	if prefersXML(r) {
+		writeXML(w, bird)
+		return
+	}
+	marshalBirds(w, bird, wantsPretty(r))
+}
+
+// getFirstBirdHandler responds with the first bird, by ID, matching the filter
+// of the query parameters, such as `/bird/first?species=eagle`
+func (s *Server) getFirstBirdHandler(w http.ResponseWriter, r *http.Request) {
+	bird, err := s.store.FindFirst(r.Context(), queryOptionsFromURL(r.URL.Query()))
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
 	}
-	return birds, nil
+	writeJSON(w, bird)
 }
 
-/*
-We will need to call the InitStore method to initialize the store. This will
-typically be done at the beginning of our application (in this case, when the server starts up)
-This can also be used to set up the store as a mock, which we will be observing
-later on
-*/
-func InitStore(s Store) {
-	store = s
+// updateBirdHandler replaces the species and description of the bird `{id}`
+// with the ones of the JSON body, and responds with the updated bird. Clients
+// that don't want to overwrite the changes of others give the version of the
+// bird they edited in `If-Match`, and get 409 Conflict when it isn't the
+// latest anymore. Without the header, the last write wins
+func (s *Server) updateBirdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := birdID(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the bird ID must be a number")
+		return
+	}
+	version, err := expectedVersion(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bird := Bird{}
+	if err := decodeBird(r, &bird); bodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bird.normalize(config.CollapseWhitespace)
+	if err := bird.validate(); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	bird.Version = version
+	err = s.store.UpdateBird(r.Context(), id, &bird)
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err == ErrVersionConflict {
+		writeJSONError(w, http.StatusConflict, err.Error()+", get the bird again and reapply the changes")
+		return
+	}
+	if isUniqueViolation(err) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("a bird of species %q already exists", bird.Species))
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	bird.ID = id
+	writeJSON(w, bird)
+}
+
+// expectedVersion reads the version of the bird that an update is based on,
+// from the `If-Match` header, as in `"3"` or `3`. It returns 0 when there is
+// no header, or when it is `*`, which any version matches
+func expectedVersion(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("If-Match must be the version of the bird, got %q", header)
+	}
+	return version, nil
+}
+
+// birdPatch is the body of a PATCH, where the fields left out, or null, are
+// kept as they are
+type birdPatch struct {
+	Species     *string `json:"species" validate:"omitnil,notblank,max=100"`
+	Description *string `json:"description" validate:"omitnil,maxdescription"`
+}
+
+// patchBirdHandler changes only the species and description given in the
+// JSON body of the bird `{id}`, such as `{"description":"..."}`, and responds
+// with the updated bird. A body that changes nothing is refused with a 400
+func (s *Server) patchBirdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := birdID(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the bird ID must be a number")
+		return
+	}
+
+	patch := birdPatch{}
+	if err := decodeJSON(r.Body, &patch); bodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("malformed JSON body: %v", err))
+		return
+	}
+	if patch.Species == nil && patch.Description == nil {
+		writeJSONError(w, http.StatusBadRequest, errEmptyPatch.Error())
+		return
+	}
+	for _, field := range []*string{patch.Species, patch.Description} {
+		if field != nil {
+			normalizeField(field, config.CollapseWhitespace)
+		}
+	}
+	if err := validatePayload(patch); err != nil {
+		writeValidationErrors(w, err)
+		return
+	}
+
+	err = s.store.PatchBird(r.Context(), id, patch.Species, patch.Description)
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if isUniqueViolation(err) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("a bird of species %q already exists", *patch.Species))
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	bird, err := s.store.GetBirdByID(r.Context(), id)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, bird)
+}
+
+// deleteBirdHandler deletes the bird `{id}`, and responds with 204 No Content
+func (s *Server) deleteBirdHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := birdID(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the bird ID must be a number")
+		return
+	}
+
+	err = s.store.DeleteBird(r.Context(), id)
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAllBirdsHandler deletes every bird, to reset test environments, and
+// responds with 204 No Content. As there is no undo, it needs the admin token,
+// and the request must confirm it with `?confirm=true`, or it gets a 400
+func (s *Server) deleteAllBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		writeJSONError(w, http.StatusBadRequest, "deleting every bird must be confirmed with confirm=true")
+		return
+	}
+	if err := s.store.DeleteAllBirds(r.Context()); err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBirdQRHandler responds with a PNG QR code of the bird, so that it can be
+// shared by scanning it with a phone
+func (s *Server) getBirdQRHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := birdID(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "the bird ID must be a number")
+		return
+	}
+
+	bird, err := s.store.GetBirdByID(r.Context(), id)
+	if err == ErrBirdNotFound {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	// The QR code holds the same JSON that the API responds with for the bird
+	birdBytes, err := json.Marshal(bird)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	png, err := qrcode.Encode(string(birdBytes), qrcode.Medium, 256)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// getBirdBoundsHandler responds with the first and the last bird to be
+// created, as `{"first": {...}, "last": {...}}`. Both are null when there are
+// no birds
+func (s *Server) getBirdBoundsHandler(w http.ResponseWriter, r *http.Request) {
+	first, last, err := s.store.FirstAndLastBird(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	writeJSON(w, struct {
+		First *Bird `json:"first"`
+		Last  *Bird `json:"last"`
+	}{first, last})
+}
+
+// statsDateLayout is the format of the dates used by the stats endpoints
+const statsDateLayout = "2006-01-02"
+
+// getDailyStatsHandler responds with the number of birds created on each day
+// from the `from` date up to and including the `to` date, as a JSON object
+// such as `{"2019-01-02": 3}`. Without dates, it covers the last 30 days
+func (s *Server) getDailyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(statsDateLayout, v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "to must be a date such as 2019-01-02")
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(statsDateLayout, v)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "from must be a date such as 2019-01-02")
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		writeJSONError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+
+	// The store counts up to, but not including, its end time, so we ask for
+	// the start of the day after `to`
+	counts, err := s.store.CountsByDay(r.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	writeJSON(w, counts)
+}
+
+// getBirdsByLetterHandler lists the birds whose species starts with the
+// letter `{c}`, for an A-Z index
+func (s *Server) getBirdsByLetterHandler(w http.ResponseWriter, r *http.Request) {
+	c := mux.Vars(r)["c"]
+	// The letter is matched with ILIKE, so anything but a single letter
+	// (such as `%`) has to be turned away
+	letter, size := utf8.DecodeRuneInString(c)
+	if size == 0 || size != len(c) || !unicode.IsLetter(letter) {
+		writeJSONError(w, http.StatusBadRequest, "the index must be a single letter")
+		return
+	}
+
+	birds, err := s.store.BirdsByInitial(r.Context(), c)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeBirds(w, birds)
+}
+
+// getSpeciesInitialsHandler lists the first letters of the species we have
+// birds for, such as `["E","S"]`, so that an A-Z index only links to the
+// letters that have birds
+func (s *Server) getSpeciesInitialsHandler(w http.ResponseWriter, r *http.Request) {
+	initials, err := s.store.SpeciesInitials(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	// No birds should still be a JSON array, and not `null`
+	if initials == nil {
+		initials = []string{}
+	}
+	writeJSON(w, initials)
+}
+
+// SpeciesCount is the number of birds of a species
+type SpeciesCount struct {
+	Species string `json:"species"`
+	Count   int    `json:"count"`
+}
+
+// getSpeciesCountsHandler lists every species with its number of birds, such
+// as `[{"species":"sparrow","count":3},{"species":"eagle","count":1}]`, for
+// building category filters. The most common species come first, and species
+// with as many birds are in alphabetical order
+func (s *Server) getSpeciesCountsHandler(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.store.SpeciesCounts(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	// No birds should still be a JSON array, and not `null`
+	species := make([]SpeciesCount, 0, len(counts))
+	for name, count := range counts {
+		species = append(species, SpeciesCount{Species: name, Count: count})
+	}
+	sort.Slice(species, func(i, j int) bool {
+		if species[i].Count != species[j].Count {
+			return species[i].Count > species[j].Count
+		}
+		return species[i].Species < species[j].Species
+	})
+	writeJSON(w, species)
+}
+
+// getBirdsGroupedHandler responds with all the birds grouped by their
+// species, as in `{"sparrow":[{...},{...}],"eagle":[{...}]}`
+func (s *Server) getBirdsGroupedHandler(w http.ResponseWriter, r *http.Request) {
+	birds, err := s.store.GetBirds(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+
+	grouped := map[string][]*Bird{}
+	for _, bird := range birds {
+		grouped[bird.Species] = append(grouped[bird.Species], bird)
+	}
+	writeJSON(w, grouped)
+}
+
+// defaultRecentLimit is the number of birds listed by
+// `/birds/recently-updated` when the client doesn't ask for a `limit`
+const defaultRecentLimit = 20
+
+// getRecentlyUpdatedHandler lists the birds that were updated last, most
+// recent change first
+func (s *Server) getRecentlyUpdatedHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRecentLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+
+	birds, err := s.store.RecentlyUpdated(r.Context(), limit)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeBirds(w, birds)
+}
+
+const (
+	// defaultTopLimit is the number of birds listed by `/birds/top` when the
+	// client doesn't ask for a `limit`
+	defaultTopLimit = 10
+	// maxTopLimit caps the `limit` of `/birds/top`, which is a leaderboard
+	// rather than a way to list every bird
+	maxTopLimit = 100
+)
+
+// getTopBirdsHandler lists the most viewed birds, most viewed first
+func (s *Server) getTopBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTopLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+	}
+	if limit > maxTopLimit {
+		limit = maxTopLimit
+	}
+
+	birds, err := s.store.TopBirds(r.Context(), limit)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeBirds(w, birds)
+}
+
+// getIncompleteBirdsHandler lists the birds that have no description yet, for
+// data quality dashboards
+func (s *Server) getIncompleteBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	birds, err := s.store.BirdsMissingDescription(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeBirds(w, birds)
+}
+
+// getChecksumHandler responds with a checksum of all the birds, as
+// `{"checksum": "..."}`. Sync tools compare it with the one they saw last, to
+// find out whether anything changed without downloading every bird
+func (s *Server) getChecksumHandler(w http.ResponseWriter, r *http.Request) {
+	checksum, err := s.store.DatasetChecksum(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]string{"checksum": checksum})
+}
+
+// getMaxBirdIDHandler responds with the highest bird ID, as `{"max_id": 42}`,
+// or 0 when there are no birds. Polling clients compare it with the highest ID
+// they have seen, to find out whether there are new birds to fetch
+func (s *Server) getMaxBirdIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := s.store.MaxBirdID(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"max_id": id})
+}
+
+// getBirdCountHandler responds with the number of birds, as `{"count": 42}`,
+// for dashboards that don't need the birds themselves. It is the JSON
+// counterpart of `HEAD /bird`
+func (s *Server) getBirdCountHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := s.store.CountBirds(r.Context())
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"count": count})
+}
+
+// getStaleBirdsHandler lists the birds that haven't changed since the
+// `before` query parameter, an RFC 3339 timestamp, as candidates for cleanup
+func (s *Server) getStaleBirdsHandler(w http.ResponseWriter, r *http.Request) {
+	before, err := time.Parse(time.RFC3339, r.URL.Query().Get("before"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "before must be an RFC 3339 timestamp")
+		return
+	}
+
+	birds, err := s.store.StaleBirds(r.Context(), before)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	writeBirds(w, birds)
+}
+
+// Our store will have two methods, to add a new bird,
+// and to get all existing birds
+// Each method returns an error, in case something goes wrong
+type Store interface {
+	// Ping checks that the store can be reached
+	Ping(ctx context.Context) error
+	// SelfTest checks that the store actually answers queries, which a
+	// connection that can be reached doesn't guarantee
+	SelfTest(ctx context.Context) error
+	// CreateBird stores a new bird, and fills in the ID and timestamps it
+	// was given
+	CreateBird(ctx context.Context, bird *Bird) error
+	// CreateBirds adds all the birds at once, and fills in the IDs and
+	// timestamps they were given. Either all of them are created, or none are
+	CreateBirds(ctx context.Context, birds []*Bird) error
+	// ImportBirds creates the birds with the IDs they already have, such as
+	// birds restored from a backup. `strategy` decides what happens when an
+	// ID is taken, and the outcome for each bird is returned in order. Either
+	// the whole import succeeds, or nothing is changed
+	ImportBirds(ctx context.Context, birds []*Bird, strategy ConflictStrategy) ([]ImportOutcome, error)
+	// GetBirds returns every bird, newest first. Birds created at the same
+	// time, such as in a batch, come by descending ID
+	GetBirds(ctx context.Context) ([]*Bird, error)
+	// CountBirds returns the number of birds
+	CountBirds(ctx context.Context) (int, error)
+	// MaxBirdID returns the highest bird ID, or 0 when there are no birds
+	MaxBirdID(ctx context.Context) (int, error)
+	// DatasetChecksum returns a hash of every bird, which changes whenever a
+	// bird is created, changed or removed
+	DatasetChecksum(ctx context.Context) (string, error)
+	// EachBird calls `fn` with every bird, in the order of their IDs, as they
+	// are read. It stops at, and returns, the first error from `fn`
+	EachBird(ctx context.Context, fn func(*Bird) error) error
+	// GetBirdsPage returns `limit` birds, starting at `offset`, in the order
+	// of their IDs
+	GetBirdsPage(ctx context.Context, limit, offset int) (*Page[Bird], error)
+	// GetBirdsPageWithFacets returns `limit` of the birds selected by `opts`,
+	// starting at `offset`, in the order of their IDs, along with the counts
+	// of the facets over all of the selected birds
+	GetBirdsPageWithFacets(ctx context.Context, opts QueryOptions, limit, offset int) (*FacetedPage, error)
+	// BirdsAfter returns up to `limit` birds whose ID is above `afterID`, in
+	// the order of their IDs
+	BirdsAfter(ctx context.Context, afterID, limit int) ([]*Bird, error)
+	// GetBirdByID returns ErrBirdNotFound when there is no bird with the ID
+	GetBirdByID(ctx context.Context, id int) (*Bird, error)
+	// FindFirst returns the bird with the lowest ID among the ones selected by
+	// `opts`, or ErrBirdNotFound when there are none
+	FindFirst(ctx context.Context, opts QueryOptions) (*Bird, error)
+	// SchemaVersion returns the version of the schema recorded in the store,
+	// or 0 when none was recorded
+	SchemaVersion(ctx context.Context) (int, error)
+	// UpdateColumns changes only the given columns of the bird, keyed by
+	// column name. Columns outside of `updatableColumns` are rejected with an
+	// error, and ErrBirdNotFound is returned when there is no bird with the ID
+	UpdateColumns(ctx context.Context, id int, fields map[string]any) error
+	// UpdateBird replaces the species and description of the bird with the
+	// ones of `bird`, which is then filled with the rest of the updated bird.
+	// When `bird` has a version, the bird is only updated if it is still at
+	// that version, and ErrVersionConflict is returned otherwise. It returns
+	// ErrBirdNotFound when there is no bird with the ID
+	UpdateBird(ctx context.Context, id int, bird *Bird) error
+	// PatchBird changes only the fields of the bird that aren't nil, and
+	// leaves the others as they are. It returns errEmptyPatch when both are
+	// nil, and ErrBirdNotFound when there is no bird with the ID
+	PatchBird(ctx context.Context, id int, species, description *string) error
+	// IncrementViews adds one to the number of times the bird was viewed, in
+	// a single step, so that concurrent views are all counted. It returns
+	// ErrBirdNotFound when there is no bird with the ID
+	IncrementViews(ctx context.Context, id int) error
+	// DeleteBird returns ErrBirdNotFound when there is no bird with the ID
+	DeleteBird(ctx context.Context, id int) error
+	// DeleteAllBirds deletes every bird, to reset test environments
+	DeleteAllBirds(ctx context.Context) error
+	// DeleteBirdsMatching deletes every bird selected by `opts`, and returns
+	// how many were deleted. Options that don't filter anything are refused
+	// with errEmptyFilter, rather than deleting every bird
+	DeleteBirdsMatching(ctx context.Context, opts QueryOptions) (int, error)
+	// ReplaceDescription sets the description of every bird whose description
+	// is exactly `placeholder` to `replacement`, and returns how many changed
+	ReplaceDescription(ctx context.Context, placeholder, replacement string) (int, error)
+	// RecentBirds returns the `limit` most recently created birds, newest first
+	RecentBirds(ctx context.Context, limit int) ([]*Bird, error)
+	// RecentlyUpdated returns the `limit` most recently updated birds, newest
+	// change first
+	RecentlyUpdated(ctx context.Context, limit int) ([]*Bird, error)
+	// TopBirds returns the `limit` most viewed birds, most viewed first. Birds
+	// with as many views are ordered by ID
+	TopBirds(ctx context.Context, limit int) ([]*Bird, error)
+	// FirstAndLastBird returns the oldest and newest birds, or nil for both
+	// when there are none
+	FirstAndLastBird(ctx context.Context) (first, last *Bird, err error)
+	// CountsByDay counts the birds created in [from, to), keyed by the UTC
+	// date they were created on ("2006-01-02")
+	CountsByDay(ctx context.Context, from, to time.Time) (map[string]int, error)
+	// BirdsByInitial returns the birds whose species starts with `letter`,
+	// ignoring case
+	BirdsByInitial(ctx context.Context, letter string) ([]*Bird, error)
+	// FindBirdsBySpecies returns the birds whose species contains `name`,
+	// ignoring case
+	FindBirdsBySpecies(ctx context.Context, name string) ([]*Bird, error)
+	// SearchBirds returns the birds whose species contains `species`, and
+	// whose description contains `descKeyword`, both ignoring case, in the
+	// order of their species. An empty argument doesn't filter anything
+	SearchBirds(ctx context.Context, species, descKeyword string) ([]*Bird, error)
+	// BirdsBySpeciesList returns the birds whose species is exactly one of
+	// `species`, in the order of their IDs
+	BirdsBySpeciesList(ctx context.Context, species []string) ([]*Bird, error)
+	// SpeciesInitials returns the distinct first letters of the species, in
+	// upper case and in alphabetical order
+	SpeciesInitials(ctx context.Context) ([]string, error)
+	// SpeciesCounts returns the number of birds of each species
+	SpeciesCounts(ctx context.Context) (map[string]int, error)
+	// BirdsByDescriptionLength returns the birds whose description is between
+	// `min` and `max` characters long, both included
+	BirdsByDescriptionLength(ctx context.Context, min, max int) ([]*Bird, error)
+	// BirdsMissingDescription returns the birds whose description is null or
+	// empty
+	BirdsMissingDescription(ctx context.Context) ([]*Bird, error)
+	// BirdsModifiedSince returns the birds updated after `t`, oldest change first
+	BirdsModifiedSince(ctx context.Context, t time.Time) ([]*Bird, error)
+	// StaleBirds returns the birds last changed (or created, when they were
+	// never changed) before `before`, least recently changed first
+	StaleBirds(ctx context.Context, before time.Time) ([]*Bird, error)
+	// FullTextSearch returns the birds whose description matches `query`
+	FullTextSearch(ctx context.Context, query string) ([]*Bird, error)
+}
+
+// ErrBirdNotFound is returned by the store when the bird asked for doesn't exist
+var ErrBirdNotFound = errors.New("bird not found")
+
+// ErrVersionConflict is returned by the store when a bird was changed since
+// the version that the update was based on
+var ErrVersionConflict = errors.New("the bird was changed since the version given")
+
+// errEmptyPatch is returned for a patch that doesn't change any field
+var errEmptyPatch = errors.New("the patch must change the species or the description")
+
+// errNoStore is reported by the handlers of a `Server` that was given no store
+var errNoStore = errors.New("the store is not initialized")
+
+// Server holds what the handlers need to answer requests. Each server has a
+// store of its own, so that several can run side by side, as in the tests
+type Server struct {
+	store Store
+	// lastBirds is the list served by `GET /bird` during database outages,
+	// when `config.ServeStale` is on
+	lastBirds staleBirds
+}
+
+// newServer returns a server whose handlers work with `store`
+func newServer(store Store) *Server {
+	return &Server{store: store}
+}
+
+// The `dbStore` struct will implement the `Store` interface
+// It also takes the sql DB connection object, which represents
+// the database connection.
+type dbStore struct {
+	db *sql.DB
+	// batchSize is the number of rows that CreateBirds inserts with each
+	// statement. It defaults to `defaultBatchSize` when not set
+	batchSize int
+	// retries is how many more times a statement is tried when it fails on a
+	// dead connection, waiting `retryBackoff` before the first retry, and
+	// twice as long before each of the next ones. They default to
+	// `defaultRetries` and `defaultRetryBackoff` when not set
+	retries      int
+	retryBackoff time.Duration
+}
+
+// defaultBatchSize keeps each INSERT statement of a batch well below the limit
+// of 65535 parameters that postgres allows in a single statement
+const defaultBatchSize = 500
+
+// pingTimeout is how long `Ping` waits for the database, so that health checks
+// answer before the orchestrator gives up on them
+const pingTimeout = 2 * time.Second
+
+func (store *dbStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return store.db.PingContext(ctx)
+}
+
+// SelfTest runs a trivial query, and checks its result, within the same time
+// as `Ping`
+func (store *dbStore) SelfTest(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	var one int
+	if err := store.queryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return err
+	}
+	if one != 1 {
+		return fmt.Errorf("self-test query returned %d instead of 1", one)
+	}
+	return nil
+}
+
+func (store *dbStore) CreateBird(ctx context.Context, bird *Bird) error {
+	// 'Bird' is a simple struct which has "species" and "description" attributes.
+	// The rest of the bird, such as the ID it was given, is read back from the
+	// inserted row
+	created, err := scanBird(store.queryRowContext(ctx, "INSERT INTO birds(species, description) VALUES ($1,$2) RETURNING "+birdColumns,
+		bird.Species, bird.Description))
+	if err != nil {
+		return err
+	}
+	*bird = *created
+	return nil
+}
+
+func (store *dbStore) CreateBirds(ctx context.Context, birds []*Bird) error {
+	size := store.batchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	// All the chunks are inserted in one transaction, so that a failure part
+	// way through doesn't leave half of the birds behind
+	tx, err := store.beginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(birds); start += size {
+		end := start + size
+		if end > len(birds) {
+			end = len(birds)
+		}
+
+		// Build a single multi-row INSERT for the chunk, which returns the
+		// created rows in the order of the values:
+		// INSERT INTO birds(species, description) VALUES ($1,$2),($3,$4),... RETURNING ...
+		var query strings.Builder
+		query.WriteString("INSERT INTO birds(species, description) VALUES ")
+		args := make([]interface{}, 0, 2*(end-start))
+		for i, bird := range birds[start:end] {
+			if i > 0 {
+				query.WriteString(",")
+			}
+			fmt.Fprintf(&query, "($%d,$%d)", 2*i+1, 2*i+2)
+			args = append(args, bird.Species, bird.Description)
+		}
+		query.WriteString(" RETURNING " + birdColumns)
+
+		rows, err := tx.QueryContext(ctx, query.String(), args...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		created, err := scanBirds(rows)
+		rows.Close()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for i, bird := range created {
+			*birds[start+i] = *bird
+		}
+	}
+	return tx.Commit()
+}
+
+func (store *dbStore) GetBirds(ctx context.Context) ([]*Bird, error) {
+	// Query the database for all birds, and return the result to the
+	// `rows` object
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY created_at DESC, id DESC")
+	// We return incase of an error, and defer the closing of the row structure
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) EachBird(ctx context.Context, fn func(*Bird) error) error {
+	// Exports can take a while, so they read from a snapshot of the database
+	// taken when they start. Birds written in the meantime are left out as a
+	// whole, instead of showing up in a torn view
+	snapshot := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	return store.withTxOptions(ctx, snapshot, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			bird, err := scanBird(rows)
+			if err != nil {
+				return err
+			}
+			if err := fn(bird); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+func (store *dbStore) CountBirds(ctx context.Context) (int, error) {
+	var count int
+	err := store.queryRowContext(ctx, "SELECT COUNT(*) FROM birds").Scan(&count)
+	return count, err
+}
+
+func (store *dbStore) MaxBirdID(ctx context.Context) (int, error) {
+	var id int
+	err := store.queryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM birds").Scan(&id)
+	return id, err
+}
+
+func (store *dbStore) DatasetChecksum(ctx context.Context) (string, error) {
+	// Each bird is written as a JSON array, so that the values can't run into
+	// each other, and in the order of the IDs, so that the hash is stable
+	var checksum string
+	err := store.queryRowContext(ctx, `SELECT md5(coalesce(string_agg(
+		json_build_array(id, species, description, created_at, updated_at)::text, ',' ORDER BY id), ''))
+		FROM birds`).Scan(&checksum)
+	return checksum, err
+}
+
+func (store *dbStore) GetBirdsPage(ctx context.Context, limit, offset int) (*Page[Bird], error) {
+	total, err := store.CountBirds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY id LIMIT $1 OFFSET $2", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	birds, err := scanBirds(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(birds, total, limit, offset), nil
+}
+
+func (store *dbStore) BirdsAfter(ctx context.Context, afterID, limit int) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) BirdsModifiedSince(ctx context.Context, t time.Time) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE updated_at > $1 ORDER BY updated_at", t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) StaleBirds(ctx context.Context, before time.Time) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE coalesce(updated_at, created_at) < $1 ORDER BY coalesce(updated_at, created_at)", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) FullTextSearch(ctx context.Context, query string) ([]*Bird, error) {
+	// `description_tsv` holds the stemmed words of the description, and is
+	// backed by a GIN index (see schema.go). plainto_tsquery treats the query
+	// as plain text, matching every word in it, so that user input can't be a
+	// tsquery syntax error
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE description_tsv @@ plainto_tsquery('english', $1)", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) GetBirdByID(ctx context.Context, id int) (*Bird, error) {
+	bird, err := scanBird(store.queryRowContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBirdNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bird, nil
+}
+
+func (store *dbStore) FindFirst(ctx context.Context, opts QueryOptions) (*Bird, error) {
+	where, args := opts.where()
+	bird, err := scanBird(store.queryRowContext(ctx, "SELECT "+birdColumns+" FROM birds"+where+" ORDER BY id LIMIT 1", args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrBirdNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bird, nil
+}
+
+// updatableColumns are the columns of a bird that clients can change. The
+// column names of `UpdateColumns` are checked against it, since they are
+// written into the query rather than passed as parameters
+var updatableColumns = map[string]bool{
+	"species":     true,
+	"description": true,
+}
+
+func (store *dbStore) UpdateColumns(ctx context.Context, id int, fields map[string]any) error {
+	query, args, err := updateColumnsQuery(id, fields)
+	if err != nil {
+		return err
+	}
+	result, err := store.execContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrBirdNotFound
+	}
+	return nil
+}
+
+// updateColumnsQuery builds the UPDATE of `UpdateColumns`, such as:
+// UPDATE birds SET description = $1, species = $2, updated_at = now(),
+// version = version + 1 WHERE id = $3
+func updateColumnsQuery(id int, fields map[string]any) (string, []interface{}, error) {
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !updatableColumns[column] {
+			return "", nil, fmt.Errorf("column %q can't be updated", column)
+		}
+		columns = append(columns, column)
+	}
+	// The columns are sorted, so that the same update always gives the same
+	// query
+	sort.Strings(columns)
+
+	var query strings.Builder
+	query.WriteString("UPDATE birds SET ")
+	args := make([]interface{}, 0, len(columns)+1)
+	for i, column := range columns {
+		fmt.Fprintf(&query, "%s = $%d, ", column, i+1)
+		args = append(args, fields[column])
+	}
+	fmt.Fprintf(&query, "updated_at = now(), version = version + 1 WHERE id = $%d", len(columns)+1)
+	args = append(args, id)
+	return query.String(), args, nil
+}
+
+// UpdateBird locks the bird with `GetBirdForUpdate` before writing it, so
+// that its version can't change between being checked and being updated
+func (store *dbStore) UpdateBird(ctx context.Context, id int, bird *Bird) error {
+	return store.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := store.GetBirdForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if bird.Version != 0 && bird.Version != current.Version {
+			return ErrVersionConflict
+		}
+		updated, err := scanBird(tx.QueryRowContext(ctx,
+			"UPDATE birds SET species = $1, description = $2, updated_at = now(), version = version + 1 WHERE id = $3 RETURNING "+birdColumns,
+			bird.Species, bird.Description, id))
+		if err != nil {
+			return err
+		}
+		*bird = *updated
+		return nil
+	})
+}
+
+// PatchBird builds its UPDATE out of the fields that are set, like
+// `UpdateColumns`, and runs it with the bird locked by `GetBirdForUpdate`
+func (store *dbStore) PatchBird(ctx context.Context, id int, species, description *string) error {
+	fields := patchColumns(species, description)
+	if len(fields) == 0 {
+		return errEmptyPatch
+	}
+	query, args, err := updateColumnsQuery(id, fields)
+	if err != nil {
+		return err
+	}
+	return store.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := store.GetBirdForUpdate(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// patchColumns are the columns changed by a patch, for `UpdateColumns`
+func patchColumns(species, description *string) map[string]any {
+	fields := map[string]any{}
+	if species != nil {
+		fields["species"] = *species
+	}
+	if description != nil {
+		fields["description"] = *description
+	}
+	return fields
+}
+
+func (store *dbStore) IncrementViews(ctx context.Context, id int) error {
+	result, err := store.execContext(ctx, "UPDATE birds SET views = views + 1 WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrBirdNotFound
+	}
+	return nil
+}
+
+func (store *dbStore) DeleteBird(ctx context.Context, id int) error {
+	result, err := store.execContext(ctx, "DELETE FROM birds WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrBirdNotFound
+	}
+	return nil
+}
+
+func (store *dbStore) DeleteAllBirds(ctx context.Context) error {
+	_, err := store.execContext(ctx, "TRUNCATE birds")
+	return err
+}
+
+func (store *dbStore) DeleteBirdsMatching(ctx context.Context, opts QueryOptions) (int, error) {
+	if opts.isEmpty() {
+		return 0, errEmptyFilter
+	}
+	where, args := opts.where()
+	result, err := store.execContext(ctx, "DELETE FROM birds"+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+func (store *dbStore) ReplaceDescription(ctx context.Context, placeholder, replacement string) (int, error) {
+	result, err := store.execContext(ctx, "UPDATE birds SET description = $2, updated_at = now(), version = version + 1 WHERE description = $1", placeholder, replacement)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := result.RowsAffected()
+	return int(updated), err
+}
+
+// GetBirdForUpdate reads a bird inside of the transaction `tx`, and locks its
+// row until the transaction ends. Any other transaction trying to lock the
+// same bird waits until then, so a read-modify-write of the bird made within
+// `tx` can't be overwritten by a concurrent one
+func (store *dbStore) GetBirdForUpdate(ctx context.Context, tx *sql.Tx, id int) (*Bird, error) {
+	bird, err := scanBird(tx.QueryRowContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBirdNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bird, nil
+}
+
+// withTx runs `fn` in a transaction, which is committed if `fn` succeeds, and
+// rolled back otherwise
+func (store *dbStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return store.withTxOptions(ctx, nil, fn)
+}
+
+// withTxOptions is `withTx`, with a transaction started with `opts`, such as
+// a stricter isolation level
+func (store *dbStore) withTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	tx, err := store.beginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (store *dbStore) RecentBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY created_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) RecentlyUpdated(ctx context.Context, limit int) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY updated_at DESC, id DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) TopBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY views DESC, id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+// FirstAndLastBird returns the oldest and the newest bird. Both are nil when
+// there are no birds at all
+func (store *dbStore) FirstAndLastBird(ctx context.Context) (first, last *Bird, err error) {
+	first, err = scanBird(store.queryRowContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY created_at ASC, id ASC LIMIT 1"))
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	last, err = scanBird(store.queryRowContext(ctx, "SELECT "+birdColumns+" FROM birds ORDER BY created_at DESC, id DESC LIMIT 1"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return first, last, nil
+}
+
+func (store *dbStore) CountsByDay(ctx context.Context, from, to time.Time) (map[string]int, error) {
+	// Days are counted in UTC, like the dates that the stats endpoint accepts
+	rows, err := store.queryContext(ctx, `SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), COUNT(*) FROM birds
+		WHERE created_at >= $1 AND created_at < $2 GROUP BY 1`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day string
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		counts[day] = count
+	}
+	return counts, rows.Err()
+}
+
+func (store *dbStore) BirdsByInitial(ctx context.Context, letter string) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE species ILIKE $1 || '%' ORDER BY species", letter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, so that user input is
+// matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (store *dbStore) FindBirdsBySpecies(ctx context.Context, name string) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE species ILIKE '%' || $1 || '%' ORDER BY species, id", likeEscaper.Replace(name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) SearchBirds(ctx context.Context, species, descKeyword string) ([]*Bird, error) {
+	// Empty patterns match everything, except a NULL description, which the
+	// coalesce turns into an empty one
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+` FROM birds
+		WHERE species ILIKE '%' || $1 || '%' AND coalesce(description, '') ILIKE '%' || $2 || '%'
+		ORDER BY species, id`, likeEscaper.Replace(species), likeEscaper.Replace(descKeyword))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) BirdsBySpeciesList(ctx context.Context, species []string) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE species = ANY($1) ORDER BY id", pq.Array(species))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) BirdsByDescriptionLength(ctx context.Context, min, max int) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE length(description) BETWEEN $1 AND $2 ORDER BY id", min, max)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+func (store *dbStore) SpeciesInitials(ctx context.Context) ([]string, error) {
+	rows, err := store.queryContext(ctx, "SELECT DISTINCT upper(left(species, 1)) FROM birds WHERE species <> '' ORDER BY 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var initials []string
+	for rows.Next() {
+		var initial string
+		if err := rows.Scan(&initial); err != nil {
+			return nil, err
+		}
+		initials = append(initials, initial)
+	}
+	return initials, rows.Err()
+}
+
+func (store *dbStore) SpeciesCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := store.queryContext(ctx, "SELECT species, COUNT(*) FROM birds GROUP BY species")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var species sql.NullString
+		var count int
+		if err := rows.Scan(&species, &count); err != nil {
+			return nil, err
+		}
+		counts[species.String] += count
+	}
+	return counts, rows.Err()
+}
+
+func (store *dbStore) BirdsMissingDescription(ctx context.Context) ([]*Bird, error) {
+	rows, err := store.queryContext(ctx, "SELECT "+birdColumns+" FROM birds WHERE description IS NULL OR description = '' ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanBirds(rows)
+}
+
+// birdColumns are the columns selected by every query that returns birds, in
+// the order that `scanBird` reads them. The species and description columns
+// allow NULL, which is read as an empty string
+const birdColumns = "id, coalesce(species, '') AS species, coalesce(description, '') AS description, created_at, updated_at, version"
+
+// scanBird reads a row of `birdColumns` into a bird. It accepts both the
+// single row of `QueryRow` and the current row of `Query`
+func scanBird(row interface{ Scan(...interface{}) error }) (*Bird, error) {
+	bird := &Bird{}
+	err := row.Scan(&bird.ID, &bird.Species, &bird.Description, &bird.CreatedAt, &bird.UpdatedAt, &bird.Version)
+	if err != nil {
+		return nil, err
+	}
+	return bird, nil
+}
+
+// scanBirds reads every row of a query selecting `birdColumns` into a list of
+// birds
+func scanBirds(rows *sql.Rows) ([]*Bird, error) {
+	// Create the data structure that is returned from the function.
+	// By default, this will be an empty array of birds
+	birds := []*Bird{}
+	for rows.Next() {
+		// For each row returned by the table, create a pointer to a bird with
+		// its attributes populated, and return incase of an error
+		bird, err := scanBird(rows)
+		if err != nil {
+			return nil, err
+		}
+		// Finally, append the result to the returned array, and repeat for
+		// the next row
+		birds = append(birds, bird)
+	}
+	return birds, rows.Err()
+}
+
+// openDBStore connects to the postgres database at `dataSourceName`, and
+// returns a store for it. Connections run the `DBInitSQL` statements of the
+// configuration when they are established, and bulk inserts use its
+// `BatchInsertSize`. The connection is checked and the schema migrated before
+// the store is returned, so that the caller can choose what to do without a
+// database
+func openDBStore(dataSourceName string) (*dbStore, error) {
+	db, err := openDB(dataSourceName, config.DBInitSQL)
+	if err != nil {
+		return nil, fmt.Errorf("opening the database: %w", err)
+	}
+	return newDBStore(db)
+}
+
+// newDBStore makes a store from an opened pool of connections, which is
+// closed on error
+func newDBStore(db *sql.DB) (*dbStore, error) {
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to the database: %w", err)
+	}
+	s := &dbStore{db: db, batchSize: config.BatchInsertSize}
+	if err := s.Migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating the database: %w", err)
+	}
+	return s, nil
+}
+
+func (store *dbStore) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := store.queryRowContext(ctx, "SELECT version FROM schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// Migrate creates the `birds` table on a fresh database, and brings the one of
+// an earlier version of the application up to date, by running `schemaSQL`
+func (store *dbStore) Migrate(ctx context.Context) error {
+	_, err := store.execContext(ctx, schemaSQL())
+	return err
 }
@@ -4,13 +4,28 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestHandler(t *testing.T) {
@@ -57,7 +72,7 @@ func TestHandler(t *testing.T) {
 func TestRouter(t *testing.T) {
 	// Instantiate the router using the constructor function that
 	// we defined previously
-	r := newRouter()
+	r := newRouter(newServer(nil))
 
 	// Create a new server using the "httptest" libraries `NewServer` method
 	// Documentation : https://golang.org/pkg/net/http/httptest/#NewServer
@@ -99,7 +114,7 @@ func TestRouter(t *testing.T) {
 }
 
 func TestRouterForNonExistentRoute(t *testing.T) {
-	r := newRouter()
+	r := newRouter(newServer(nil))
 	mockServer := httptest.NewServer(r)
 	// Most of the code is similar. The only difference is that now we make a
 	//request to a route we know we didn't define, like the `POST /hello` route.
@@ -131,7 +146,7 @@ func TestRouterForNonExistentRoute(t *testing.T) {
 }
 
 func TestStaticFileServer(t *testing.T) {
-	r := newRouter()
+	r := newRouter(newServer(nil))
 	mockServer := httptest.NewServer(r)
 
 	// We want to hit the `GET /assets/` route to get the index.html file response
@@ -156,11 +171,37 @@ func TestStaticFileServer(t *testing.T) {
 	}
 }
 
-func TestGetBirdsHandler(t *testing.T) {
+func TestStaticFileServerAssetDir(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.AssetDir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(config.AssetDir, "known.txt"), []byte("served from elsewhere"), 0644); err != nil {
+		t.Fatal(err)
+	}
 
-	birds = []Bird{
-		{"sparrow", "A small harmless bird"},
+	mockServer := httptest.NewServer(newRouter(newServer(nil)))
+	defer mockServer.Close()
+
+	resp, err := http.Get(mockServer.URL + "/assets/known.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
 	}
+	if resp.StatusCode != http.StatusOK || string(b) != "served from elsewhere" {
+		t.Errorf("expected the file of the asset directory, got %d %q", resp.StatusCode, b)
+	}
+}
+
+func TestGetBirdsHandler(t *testing.T) {
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{
+		{ID: 1, Species: "sparrow", Description: "A small harmless bird"},
+	}, nil).Once()
 
 	req, err := http.NewRequest("GET", "", nil)
 
@@ -169,7 +210,7 @@ func TestGetBirdsHandler(t *testing.T) {
 	}
 	recorder := httptest.NewRecorder()
 
-	hf := http.HandlerFunc(getBirdHandler)
+	hf := http.HandlerFunc(srv.getBirdHandler)
 
 	hf.ServeHTTP(recorder, req)
 
@@ -178,7 +219,7 @@ func TestGetBirdsHandler(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := Bird{"sparrow", "A small harmless bird"}
+	expected := Bird{ID: 1, Species: "sparrow", Description: "A small harmless bird"}
 	b := []Bird{}
 	err = json.NewDecoder(recorder.Body).Decode(&b)
 
@@ -186,17 +227,115 @@ func TestGetBirdsHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if len(b) != 1 {
+		t.Fatalf("handler returned %d birds, want 1", len(b))
+	}
 	actual := b[0]
 
 	if actual != expected {
 		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
 	}
+
+	// The list should have come from the store
+	mockStore.AssertExpectations(t)
 }
-func TestCreateBirdsHandler(t *testing.T) {
 
-	birds = []Bird{
-		{"sparrow", "A small harmless bird"},
+func TestServersHaveTheirOwnStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		species string
+	}{
+		{"sparrows", "sparrow"},
+		{"eagles", "eagle"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mockStore := InitMockStore()
+			mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: tt.species}}, nil)
+			router := newRouter(newServer(mockStore))
+
+			for i := 0; i < 20; i++ {
+				req, err := http.NewRequest("GET", "/bird", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+
+				birds := []Bird{}
+				if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+					t.Fatal(err)
+				}
+				if len(birds) != 1 || birds[0].Species != tt.species {
+					t.Fatalf("the server answered with the birds of another store: %+v", birds)
+				}
+			}
+			mockStore.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetBirdsHandlerWithoutStore(t *testing.T) {
+	req, err := http.NewRequest("GET", "/bird", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(newServer(nil).getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusInternalServerError)
+	}
+	body := map[string]string{}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("handler should return a JSON error: %v", err)
+	}
+	if body["error"] == "" {
+		t.Errorf("handler returned no error message: %v", body)
+	}
+}
+
+func TestGetBirdsHandlerStoreError(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird(nil), errors.New("connection refused")).Once()
+
+	req, err := http.NewRequest("GET", "/bird", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusInternalServerError)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != jsonContentType() {
+		t.Errorf("handler returned wrong content type: got %q want %q", contentType, jsonContentType())
 	}
+	// The client gets a generic message, and not the database error
+	expected := `{"error":"` + errInternal.Error() + `"}` + "\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected body: got %q want %q", body, expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandler(t *testing.T) {
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	// We expect the store to be given the bird from the form, and tell the
+	// mock to return a `nil` error
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(nil).Once()
 
 	form := newCreateBirdForm()
 	req, err := http.NewRequest("POST", "", bytes.NewBufferString(form.Encode()))
@@ -208,26 +347,197 @@ func TestCreateBirdsHandler(t *testing.T) {
 	}
 	recorder := httptest.NewRecorder()
 
-	hf := http.HandlerFunc(createBirdHandler)
+	hf := http.HandlerFunc(srv.createBirdHandler)
 
 	hf.ServeHTTP(recorder, req)
 
 	if status := recorder.Code; status != http.StatusFound {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+			status, http.StatusFound)
 	}
 
-	expected := Bird{"eagle", "A bird of prey"}
+	// The bird from the form should have been given to the store
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandlerStoreError(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(errors.New("connection refused")).Once()
 
+	form := newCreateBirdForm()
+	req, err := http.NewRequest("POST", "", bytes.NewBufferString(form.Encode()))
 	if err != nil {
 		t.Fatal(err)
 	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
 
-	actual := birds[1]
+	hf := http.HandlerFunc(srv.createBirdHandler)
+	hf.ServeHTTP(recorder, req)
 
-	if actual != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+	// The client should be told that the bird wasn't saved, and not be
+	// redirected as if it had been
+	if status := recorder.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusInternalServerError)
+	}
+	if location := recorder.Header().Get("Location"); location != "" {
+		t.Errorf("handler should not redirect, got Location %q", location)
+	}
+	if body := recorder.Body.String(); body == "" {
+		t.Errorf("handler should describe the error")
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandlerDuplicateSpecies(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	violation := &pq.Error{Code: uniqueViolation, Message: `duplicate key value violates unique constraint "birds_species_key"`}
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(violation).Once()
+
+	req, err := http.NewRequest("POST", "/bird", strings.NewReader(`{"species":"eagle","description":"A bird of prey"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.createBirdHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict)
+	}
+	expected := `{"error":"a bird of species \"eagle\" already exists, update it instead"}` + "\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			recorder.Body.String(), expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&pq.Error{Code: uniqueViolation}, true},
+		{fmt.Errorf("inserting: %w", &pq.Error{Code: uniqueViolation}), true},
+		// The same refusal, from the in-memory store
+		{ErrSpeciesExists, true},
+		// A check constraint, such as the length of the description
+		{&pq.Error{Code: "23514"}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err); got != tt.expected {
+			t.Errorf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestCreateBirdsHandlerJSON(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(nil).Once()
+
+	hf := http.HandlerFunc(srv.createBirdHandler)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"valid bird", `{"species":"eagle","description":"A bird of prey"}`, http.StatusFound},
+		{"malformed JSON", `{"species":"eagle"`, http.StatusBadRequest},
+		{"trailing JSON", `{"species":"eagle"}{"species":"owl"}`, http.StatusBadRequest},
+		{"missing species", `{"description":"A bird of prey"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("POST", "/bird", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		// Errors should be described in JSON, for API clients
+		if recorder.Code == http.StatusBadRequest {
+			body := map[string]string{}
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil || body["error"] == "" {
+				t.Errorf("%s: handler should return a JSON error, got %v", tt.name, err)
+			}
+		}
+	}
+
+	// Only the valid bird should have been stored
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandlerCreated(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	// The store gives the bird its ID
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(0).(*Bird).ID = 7
+	})
+
+	hf := http.HandlerFunc(srv.createBirdHandler)
+
+	tests := []struct {
+		name             string
+		contentType      string
+		body             string
+		accept           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"API client", "application/json", `{"species":"eagle","description":"A bird of prey"}`, "application/json", http.StatusCreated, "/bird/7"},
+		{"API client sending a form", "application/x-www-form-urlencoded", newCreateBirdForm().Encode(), "text/plain, application/json;q=0.9", http.StatusCreated, "/bird/7"},
+		{"HTML form", "application/x-www-form-urlencoded", newCreateBirdForm().Encode(), "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusFound, "/assets/"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("POST", "/bird", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("Accept", tt.accept)
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		if location := recorder.Header().Get("Location"); location != tt.expectedLocation {
+			t.Errorf("%s: wrong Location: got %q want %q", tt.name, location, tt.expectedLocation)
+		}
+		if tt.expectedStatus != http.StatusCreated {
+			continue
+		}
+		bird := Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&bird); err != nil {
+			t.Fatal(err)
+		}
+		if bird.ID != 7 || bird.Species != "eagle" {
+			t.Errorf("%s: handler returned unexpected bird: %+v", tt.name, bird)
+		}
 	}
+
+	mockStore.AssertExpectations(t)
 }
 
 func newCreateBirdForm() *url.Values {
@@ -236,3 +546,1708 @@ func newCreateBirdForm() *url.Values {
 	form.Set("description", "A bird of prey")
 	return &form
 }
+
+func TestGetBirdsModifiedSinceHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+
+	since := time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+	changed := time.Date(2019, 1, 3, 10, 0, 0, 0, time.UTC)
+	mockStore.On("BirdsModifiedSince", since).Return([]*Bird{
+		{Species: "sparrow", Description: "A small harmless bird", UpdatedAt: changed},
+	}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/bird?modified_since=2019-01-02T15:04:05Z", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	b := []Bird{}
+	err = json.NewDecoder(recorder.Body).Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 1 {
+		t.Fatalf("handler returned wrong number of birds: got %d want 1", len(b))
+	}
+
+	expected := Bird{Species: "sparrow", Description: "A small harmless bird", UpdatedAt: changed}
+	actual := b[0]
+
+	if actual != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	// the store should have been asked for the birds changed since the
+	// timestamp in the query
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsModifiedSinceHandlerBadTimestamp(t *testing.T) {
+	srv := newServer(InitMockStore())
+
+	req, err := http.NewRequest("GET", "/bird?modified_since=yesterday", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+}
+
+func TestGetBirdsFullTextSearchHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("FullTextSearch", "flies").Return([]*Bird{
+		{Species: "swift", Description: "Flying for months without landing"},
+	}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/bird?fts=flies", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	b := []Bird{}
+	if err := json.NewDecoder(recorder.Body).Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 1 || b[0].Species != "swift" {
+		t.Errorf("handler returned unexpected body: got %v", b)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsBySpeciesHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("FindBirdsBySpecies", "EAGLE").Return([]*Bird{{ID: 2, Species: "bald eagle"}, {ID: 5, Species: "golden eagle"}}, nil).Once()
+	mockStore.On("FindBirdsBySpecies", "dodo").Return([]*Bird{}, nil).Once()
+	mockStore.On("BirdsBySpeciesList", []string{"sparrow", "robin"}).Return([]*Bird{{ID: 1, Species: "sparrow"}, {ID: 4, Species: "robin"}}, nil).Twice()
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}, {ID: 2, Species: "bald eagle"}}, nil).Once()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	tests := []struct {
+		url             string
+		expectedSpecies []string
+	}{
+		{"/bird?species=EAGLE", []string{"bald eagle", "golden eagle"}},
+		{"/bird?species=dodo", []string{}},
+		// Several species are matched exactly
+		{"/bird?species=sparrow&species=robin", []string{"sparrow", "robin"}},
+		{"/bird?species=sparrow,%20robin", []string{"sparrow", "robin"}},
+		// Without the parameter, every bird is listed
+		{"/bird", []string{"sparrow", "bald eagle"}},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.url, status, http.StatusOK)
+		}
+		birds := []Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+			t.Fatal(err)
+		}
+		species := []string{}
+		for _, bird := range birds {
+			species = append(species, bird.Species)
+		}
+		if !reflect.DeepEqual(species, tt.expectedSpecies) {
+			t.Errorf("%s: handler returned unexpected birds: got %v want %v", tt.url, species, tt.expectedSpecies)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsByKeywordHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("SearchBirds", "", "prey").Return([]*Bird{{ID: 2, Species: "bald eagle"}, {ID: 3, Species: "owl"}}, nil).Once()
+	mockStore.On("SearchBirds", "eagle", "prey").Return([]*Bird{{ID: 2, Species: "bald eagle"}}, nil).Once()
+	mockStore.On("FindBirdsBySpecies", "eagle").Return([]*Bird{{ID: 2, Species: "bald eagle"}, {ID: 5, Species: "golden eagle"}}, nil).Once()
+	mockStore.On("SearchBirds", "", "dodo").Return(nil, errors.New("connection refused")).Once()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	tests := []struct {
+		url             string
+		expectedStatus  int
+		expectedSpecies []string
+	}{
+		{"/bird?q=prey", http.StatusOK, []string{"bald eagle", "owl"}},
+		// Both filters have to match
+		{"/bird?q=prey&species=eagle", http.StatusOK, []string{"bald eagle"}},
+		// Without a keyword, the species is searched like before
+		{"/bird?species=eagle", http.StatusOK, []string{"bald eagle", "golden eagle"}},
+		{"/bird?q=dodo", http.StatusInternalServerError, nil},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.url, status, tt.expectedStatus)
+			continue
+		}
+		if tt.expectedStatus != http.StatusOK {
+			continue
+		}
+		birds := []Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+			t.Fatal(err)
+		}
+		species := []string{}
+		for _, bird := range birds {
+			species = append(species, bird.Species)
+		}
+		if !reflect.DeepEqual(species, tt.expectedSpecies) {
+			t.Errorf("%s: handler returned unexpected birds: got %v want %v", tt.url, species, tt.expectedSpecies)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsEmptyFilterResult(t *testing.T) {
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		// By default, a filter without matches is an empty list
+		{"/bird?fts=dodo", http.StatusOK, "[]"},
+		// ...unless the client asks for a 404 instead
+		{"/bird?fts=dodo&not_found_on_empty=true", http.StatusNotFound, `{"error":"no birds match the filter"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		mockStore := InitMockStore()
+		srv := newServer(mockStore)
+		mockStore.On("FullTextSearch", "dodo").Return([]*Bird{}, nil).Once()
+
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getBirdHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.url, status, tt.expectedStatus)
+		}
+		if body := recorder.Body.String(); body != tt.expectedBody {
+			t.Errorf("%s: handler returned unexpected body: got %q want %q", tt.url, body, tt.expectedBody)
+		}
+	}
+}
+
+func TestGetBirdBoundsHandler(t *testing.T) {
+	first := &Bird{ID: 1, Species: "sparrow", Description: "A small harmless bird"}
+	last := &Bird{ID: 9, Species: "eagle", Description: "A bird of prey"}
+
+	tests := []struct {
+		name         string
+		first, last  *Bird
+		expectedBody string
+	}{
+		{"no birds", nil, nil, `{"first":null,"last":null}`},
+		{"some birds", first, last, ""},
+	}
+
+	for _, tt := range tests {
+		mockStore := InitMockStore()
+		srv := newServer(mockStore)
+		mockStore.On("FirstAndLastBird").Return(tt.first, tt.last, nil).Once()
+
+		req, err := http.NewRequest("GET", "/birds/bounds", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getBirdBoundsHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, http.StatusOK)
+		}
+
+		if tt.expectedBody != "" {
+			if body := recorder.Body.String(); body != tt.expectedBody {
+				t.Errorf("%s: handler returned unexpected body: got %s want %s", tt.name, body, tt.expectedBody)
+			}
+			continue
+		}
+
+		bounds := struct{ First, Last Bird }{}
+		if err := json.NewDecoder(recorder.Body).Decode(&bounds); err != nil {
+			t.Fatal(err)
+		}
+		if bounds.First != *first || bounds.Last != *last {
+			t.Errorf("%s: handler returned unexpected body: got %v", tt.name, bounds)
+		}
+	}
+}
+
+func TestGetDailyStatsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	from := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The whole of the `to` day should be included
+	to := time.Date(2019, 1, 3, 0, 0, 0, 0, time.UTC)
+	mockStore.On("CountsByDay", from, to).Return(map[string]int{"2019-01-02": 2}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/stats/daily?from=2019-01-01&to=2019-01-02", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getDailyStatsHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	expected := `{"2019-01-02":2}`
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", body, expected)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+func TestListRootObject(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+
+	for _, listRootObject := range []bool{false, true} {
+		config.ListRootObject = listRootObject
+		mockStore := InitMockStore()
+		srv := newServer(mockStore)
+		mockStore.On("FullTextSearch", "small").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Once()
+
+		req, err := http.NewRequest("GET", "/bird?fts=small", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getBirdHandler)
+		hf.ServeHTTP(recorder, req)
+
+		// Lists are bare arrays by default, or wrapped in an object when
+		// configured
+		b := []Bird{}
+		if listRootObject {
+			wrapped := struct{ Birds *[]Bird }{&b}
+			err = json.NewDecoder(recorder.Body).Decode(&wrapped)
+		} else {
+			err = json.NewDecoder(recorder.Body).Decode(&b)
+		}
+		if err != nil {
+			t.Fatalf("ListRootObject=%v: %v", listRootObject, err)
+		}
+		if len(b) != 1 || b[0].Species != "sparrow" {
+			t.Errorf("ListRootObject=%v: handler returned unexpected birds: %v", listRootObject, b)
+		}
+	}
+}
+
+func TestGetBirdsByLetterHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("BirdsByInitial", "s").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Once()
+
+	tests := []struct {
+		letter         string
+		expectedStatus int
+	}{
+		{"s", http.StatusOK},
+		{"%", http.StatusBadRequest},
+		{"sp", http.StatusBadRequest},
+		{"1", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/birds/letter/"+url.PathEscape(tt.letter), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"c": tt.letter})
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getBirdsByLetterHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("letter %q: handler returned wrong status code: got %v want %v",
+				tt.letter, status, tt.expectedStatus)
+		}
+	}
+
+	// Only the valid letter should have reached the store
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetSpeciesInitialsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("SpeciesInitials").Return([]string{"E", "S"}, nil).Once()
+	mockStore.On("SpeciesInitials").Return(nil, nil).Once()
+
+	// The letters are listed as they come from the store, and no letters
+	// at all is still an array
+	for _, expected := range []string{`["E","S"]`, `[]`} {
+		req, err := http.NewRequest("GET", "/birds/initials", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getSpeciesInitialsHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+		if actual := recorder.Body.String(); actual != expected {
+			t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetSpeciesCountsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("SpeciesCounts").Return(map[string]int{"eagle": 1, "sparrow": 3, "robin": 1}, nil).Once()
+	mockStore.On("SpeciesCounts").Return(map[string]int{}, nil).Once()
+	router := newRouter(srv)
+
+	// The most common species come first, then the ties by name, and no
+	// species at all is still an array
+	expectedBodies := []string{
+		`[{"species":"sparrow","count":3},{"species":"eagle","count":1},{"species":"robin","count":1}]`,
+		`[]`,
+	}
+	for _, expected := range expectedBodies {
+		req, err := http.NewRequest("GET", "/bird/species", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+		if actual := recorder.Body.String(); actual != expected {
+			t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestBirdValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		bird    Bird
+		isValid bool
+	}{
+		{"valid", Bird{Species: "eagle", Description: "A bird of prey"}, true},
+		{"no description", Bird{Species: "eagle"}, true},
+		{"empty species", Bird{Description: "A bird of prey"}, false},
+		{"blank species", Bird{Species: "  \t"}, false},
+		{"species at the limit", Bird{Species: strings.Repeat("é", maxSpeciesLength)}, true},
+		{"species too long", Bird{Species: strings.Repeat("a", maxSpeciesLength+1)}, false},
+		{"description too long", Bird{Species: "eagle", Description: strings.Repeat("a", config.MaxDescriptionLength+1)}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.bird.validate()
+		if tt.isValid && err != nil {
+			t.Errorf("%s: expected the bird to be valid, got %v", tt.name, err)
+		}
+		if !tt.isValid && err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestCreateBirdsHandlerInvalidSpecies(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+
+	form := url.Values{}
+	form.Set("species", "")
+	form.Set("description", "A bird of prey")
+	req, err := http.NewRequest("POST", "", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.createBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusUnprocessableEntity)
+	}
+	expected := `{"error":"species must not be blank","errors":[{"field":"species","message":"species must not be blank"}]}` + "\n"
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected body: got %q want %q", body, expected)
+	}
+
+	// Nothing should have been stored
+	mockStore.AssertNotCalled(t, "CreateBird", mock.Anything)
+}
+
+func TestBulkCreateBirdsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CreateBirds", []*Bird{{Species: "eagle", Description: "A bird of prey"}, {Species: "robin"}}).
+		Run(func(args mock.Arguments) {
+			for i, bird := range args.Get(0).([]*Bird) {
+				bird.ID = i + 1
+			}
+		}).Return(nil).Once()
+	mockStore.On("CreateBirds", []*Bird{{Species: "owl"}}).Return(errors.New("constraint violated")).Once()
+	mockStore.On("CreateBirds", []*Bird{{Species: "swift"}, {Species: "swift"}}).Return(&pq.Error{Code: uniqueViolation}).Once()
+
+	router := newRouter(srv)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"valid batch", `[{"species":"eagle","description":"A bird of prey"},{"species":"robin"}]`, http.StatusCreated,
+			`[{"id":1,"species":"eagle","description":"A bird of prey",`},
+		{"store failure", `[{"species":"owl"}]`, http.StatusInternalServerError,
+			`{"error":"the birds could not be saved, please try again later"}`},
+		{"duplicate species", `[{"species":"swift"},{"species":"swift"}]`, http.StatusConflict,
+			`{"error":"some of the species already exist, or are given twice"}`},
+		{"invalid bird", `[{"species":"eagle"},{"species":" "}]`, http.StatusUnprocessableEntity,
+			`{"error":"bird 1: species must not be blank","errors":[{"index":1,"field":"species","message":"species must not be blank"}]}`},
+		{"missing species", `[{"description":"no species"}]`, http.StatusBadRequest,
+			`{"error":"bird 0: species is required"}`},
+		{"empty batch", `[]`, http.StatusBadRequest, `{"error":"at least one bird is required"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("POST", "/birds", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		if !strings.HasPrefix(recorder.Body.String(), tt.expectedBody) {
+			t.Errorf("%s: handler returned unexpected body: got %v want %v",
+				tt.name, recorder.Body.String(), tt.expectedBody)
+		}
+	}
+
+	// Only the batches that were entirely valid reached the store
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandlerTrimsWhitespace(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+
+	tests := []struct {
+		collapse            bool
+		species             string
+		expectedSpecies     string
+		expectedDescription string
+	}{
+		{false, " Robin ", "Robin", "Sings  at dawn"},
+		{true, " Red   robin\t", "Red robin", "Sings at dawn"},
+	}
+
+	for _, tt := range tests {
+		config.CollapseWhitespace = tt.collapse
+		mockStore := InitMockStore()
+		srv := newServer(mockStore)
+		mockStore.On("CreateBird", &Bird{Species: tt.expectedSpecies, Description: tt.expectedDescription}).Return(nil).Once()
+
+		form := url.Values{}
+		form.Set("species", tt.species)
+		form.Set("description", "\nSings  at dawn ")
+		req, err := http.NewRequest("POST", "", bytes.NewBufferString(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(srv.createBirdHandler).ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusFound {
+			t.Errorf("%q: handler returned wrong status code: got %v want %v",
+				tt.species, status, http.StatusFound)
+		}
+		mockStore.AssertExpectations(t)
+	}
+}
+
+func TestCreateBirdsHandlerDescriptionLength(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CreateBird", mock.AnythingOfType("*main.Bird")).Return(nil)
+
+	tests := []struct {
+		description    string
+		expectedStatus int
+	}{
+		{strings.Repeat("a", config.MaxDescriptionLength), http.StatusFound},
+		{strings.Repeat("a", config.MaxDescriptionLength+1), http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{}
+		form.Set("species", "eagle")
+		form.Set("description", tt.description)
+		req, err := http.NewRequest("POST", "", bytes.NewBufferString(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.createBirdHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("description of %d characters: handler returned wrong status code: got %v want %v",
+				len(tt.description), status, tt.expectedStatus)
+		}
+	}
+
+	// Only the bird within the limit should have been created
+	mockStore.AssertNumberOfCalls(t, "CreateBird", 1)
+}
+
+func TestGetBirdsPageHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirdsPage", 2, 2).Return(newPage([]*Bird{{ID: 3}, {ID: 4}}, 5, 2, 2), nil).Once()
+
+	req, err := http.NewRequest("GET", "/bird?limit=2&offset=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	page := Page[Bird]{}
+	if err := json.NewDecoder(recorder.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Total != 5 || !page.HasNext {
+		t.Errorf("handler returned unexpected page: %+v", page)
+	}
+
+	// Invalid page parameters should be turned away
+	for _, query := range []string{"limit=0", "limit=-5", "limit=ten", "limit=2&offset=-1", "offset=two"} {
+		req, err := http.NewRequest("GET", "/bird?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+		if status := recorder.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetBirdsPageHandlerLimits(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirdsPage", defaultPageLimit, 40).Return(newPage([]*Bird{}, 5, defaultPageLimit, 40), nil).Once()
+	mockStore.On("GetBirdsPage", maxPageLimit, 0).Return(newPage([]*Bird{}, 5, maxPageLimit, 0), nil).Twice()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	// An offset alone gets the default limit, and limits over the maximum are
+	// cut down to it
+	for _, query := range []string{"offset=40", "limit=100", "limit=1000"} {
+		req, err := http.NewRequest("GET", "/bird?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+		if status := recorder.Code; status != http.StatusOK {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				query, status, http.StatusOK)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsByDescriptionLengthHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("BirdsByDescriptionLength", 0, 10).Return([]*Bird{{Species: "stub", Description: ""}}, nil).Once()
+	mockStore.On("BirdsByDescriptionLength", 5, config.MaxDescriptionLength).Return([]*Bird{}, nil).Once()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+	}{
+		{"max_description_length=10", http.StatusOK},
+		{"min_description_length=5", http.StatusOK},
+		{"min_description_length=-1", http.StatusBadRequest},
+		{"max_description_length=long", http.StatusBadRequest},
+		{"min_description_length=10&max_description_length=5", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird?"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.query, status, tt.expectedStatus)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsAsMapHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("FullTextSearch", "bird").Return([]*Bird{
+		{ID: 1, Species: "sparrow", Description: "A small bird"},
+		{ID: 7, Species: "eagle", Description: "A bird of prey"},
+	}, nil).Once()
+	mockStore.On("FullTextSearch", "nothing").Return([]*Bird{}, nil).Once()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	req, err := http.NewRequest("GET", "/bird?fts=bird&as=map", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	// The birds should be keyed by their ID, as strings
+	byID := map[string]Bird{}
+	if err := json.NewDecoder(recorder.Body).Decode(&byID); err != nil {
+		t.Fatal(err)
+	}
+	if len(byID) != 2 || byID["1"].Species != "sparrow" || byID["7"].Species != "eagle" {
+		t.Errorf("handler returned unexpected birds: %+v", byID)
+	}
+
+	// No birds is an empty object
+	req, err = http.NewRequest("GET", "/bird?fts=nothing&as=map", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+	if body := recorder.Body.String(); body != "{}" {
+		t.Errorf("handler returned unexpected body: got %v want %v", body, "{}")
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCountBirdsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CountBirds").Return(42, nil).Once()
+
+	// The request goes through the router, to check that HEAD is routed to
+	// the count rather than to the full list
+	mockServer := httptest.NewServer(newRouter(srv))
+	defer mockServer.Close()
+
+	resp, err := http.Head(mockServer.URL + "/bird")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status should be ok, got %d", resp.StatusCode)
+	}
+	if count := resp.Header.Get("X-Total-Count"); count != "42" {
+		t.Errorf("X-Total-Count should be 42, got %q", count)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 0 {
+		t.Errorf("body should be empty, got %q", body)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsGroupedHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{
+		{ID: 1, Species: "sparrow", Description: "first"},
+		{ID: 2, Species: "eagle", Description: "first"},
+		{ID: 3, Species: "sparrow", Description: "second"},
+		{ID: 4, Species: "eagle", Description: "second"},
+		{ID: 5, Species: "swift", Description: "first"},
+	}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/grouped", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdsGroupedHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	grouped := map[string][]Bird{}
+	if err := json.NewDecoder(recorder.Body).Decode(&grouped); err != nil {
+		t.Fatal(err)
+	}
+	if len(grouped) != 3 {
+		t.Errorf("birds should be in 3 groups, got %d", len(grouped))
+	}
+	// Each group should keep the birds in the order they came from the store
+	sparrows := grouped["sparrow"]
+	if len(sparrows) != 2 || sparrows[0].ID != 1 || sparrows[1].ID != 3 {
+		t.Errorf("wrong sparrow group: %+v", sparrows)
+	}
+	if len(grouped["eagle"]) != 2 || len(grouped["swift"]) != 1 {
+		t.Errorf("wrong groups: %+v", grouped)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetRecentlyUpdatedHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("RecentlyUpdated", defaultRecentLimit).Return([]*Bird{{ID: 2, Species: "eagle"}}, nil).Once()
+	mockStore.On("RecentlyUpdated", 5).Return([]*Bird{}, nil).Once()
+
+	hf := http.HandlerFunc(srv.getRecentlyUpdatedHandler)
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+	}{
+		{"", http.StatusOK},
+		{"?limit=5", http.StatusOK},
+		{"?limit=0", http.StatusBadRequest},
+		{"?limit=many", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/birds/recently-updated"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%q: handler returned wrong status code: got %v want %v",
+				tt.query, status, tt.expectedStatus)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetIncompleteBirdsHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("BirdsMissingDescription").Return([]*Bird{{ID: 2, Species: "eagle"}}, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/incomplete", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getIncompleteBirdsHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	birds := []Bird{}
+	if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+		t.Fatal(err)
+	}
+	if len(birds) != 1 || birds[0].Species != "eagle" {
+		t.Errorf("handler returned unexpected birds: %+v", birds)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetStaleBirdsHandler(t *testing.T) {
+	before := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("StaleBirds", before).Return([]*Bird{{ID: 3, Species: "dodo"}}, nil).Once()
+
+	hf := http.HandlerFunc(srv.getStaleBirdsHandler)
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/birds/stale?before=2019-01-02T00:00:00Z", http.StatusOK},
+		{"/birds/stale", http.StatusBadRequest},
+		{"/birds/stale?before=2019-01-02", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.url, status, tt.expectedStatus)
+		}
+		if tt.expectedStatus != http.StatusOK {
+			continue
+		}
+		birds := []Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+			t.Fatal(err)
+		}
+		if len(birds) != 1 || birds[0].Species != "dodo" {
+			t.Errorf("handler returned unexpected birds: %+v", birds)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdsHandlerServesStale(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.ServeStale = true
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow"}}, nil).Once()
+	mockStore.On("GetBirds").Return(nil, errors.New("connection refused")).Once()
+
+	hf := http.HandlerFunc(srv.getBirdHandler)
+
+	// The first request reads the birds from the store, which primes the
+	// cache...
+	req, err := http.NewRequest("GET", "/bird", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+	if stale := recorder.Header().Get("X-Served-Stale"); stale != "" {
+		t.Errorf("fresh response was flagged as stale")
+	}
+
+	// ...so that the same birds are served once the database is down
+	recorder = httptest.NewRecorder()
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if stale := recorder.Header().Get("X-Served-Stale"); stale != "true" {
+		t.Errorf("X-Served-Stale should be true, got %q", stale)
+	}
+	b := []Bird{}
+	if err := json.NewDecoder(recorder.Body).Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 1 || b[0].Species != "sparrow" {
+		t.Errorf("handler returned unexpected birds: %+v", b)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestOpenDBStoreConnectionError(t *testing.T) {
+	// Nothing listens on port 1, so the connection is refused right away
+	s, err := openDBStore("host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err == nil {
+		t.Fatal("expected an error when the database can't be reached")
+	}
+	if s != nil {
+		t.Errorf("expected no store alongside the error, got %+v", s)
+	}
+}
+
+// recordingConnector is a database that accepts every statement, and keeps
+// the ones it runs, to check which SQL is sent without a real database
+type recordingConnector struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (c *recordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &recordingConn{c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver { return nil }
+
+type recordingConn struct{ connector *recordingConnector }
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+	c.connector.statements = append(c.connector.statements, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func TestNewDBStoreMigrates(t *testing.T) {
+	connector := &recordingConnector{}
+	if _, err := newDBStore(sql.OpenDB(connector)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema, which creates the birds table, was run exactly once
+	if len(connector.statements) != 1 || connector.statements[0] != schemaSQL() {
+		t.Fatalf("expected the schema to be run once, got %q", connector.statements)
+	}
+	if !strings.Contains(connector.statements[0], "CREATE TABLE IF NOT EXISTS birds") {
+		t.Errorf("the schema doesn't create the birds table: %q", connector.statements[0])
+	}
+}
+
+func TestDBStoreCancelledContext(t *testing.T) {
+	// Nothing listens on port 1, but a cancelled context should give up before
+	// even trying to connect
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &dbStore{db: db}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if _, err := s.GetBirds(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if err := s.CreateBird(ctx, &Bird{Species: "sparrow"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("the store should return right away, took %v", took)
+	}
+}
+
+func TestGetBirdByIDCountsViews(t *testing.T) {
+	s := newMemStore()
+	if err := s.CreateBird(context.Background(), &Bird{Species: "sparrow"}); err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter(newServer(s))
+
+	// Every view is counted, however many arrive at the same time
+	const views = 50
+	var wg sync.WaitGroup
+	for i := 0; i < views; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/bird/1", nil)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.views[1] != views {
+		t.Errorf("expected %d views, got %d", views, s.views[1])
+	}
+}
+
+func TestGetTopBirdsHandler(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{{Species: "sparrow"}, {Species: "eagle"}, {Species: "swift"}, {Species: "owl"}}); err != nil {
+		t.Fatal(err)
+	}
+	for id, views := range map[int]int{1: 2, 2: 5, 3: 0, 4: 2} {
+		for i := 0; i < views; i++ {
+			if err := s.IncrementViews(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	router := newRouter(newServer(s))
+
+	tests := []struct {
+		query           string
+		expectedStatus  int
+		expectedSpecies []string
+	}{
+		// Birds with as many views keep the order of their IDs
+		{"", http.StatusOK, []string{"eagle", "sparrow", "owl", "swift"}},
+		{"?limit=2", http.StatusOK, []string{"eagle", "sparrow"}},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?limit=many", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/birds/top"+tt.query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.query, recorder.Code, tt.expectedStatus)
+			continue
+		}
+		if tt.expectedStatus != http.StatusOK {
+			continue
+		}
+		var birds []Bird
+		if err := json.NewDecoder(recorder.Body).Decode(&birds); err != nil {
+			t.Fatal(err)
+		}
+		species := []string{}
+		for _, bird := range birds {
+			species = append(species, bird.Species)
+		}
+		if !reflect.DeepEqual(species, tt.expectedSpecies) {
+			t.Errorf("%s: incorrect leaderboard, wanted %v, got %v", tt.query, tt.expectedSpecies, species)
+		}
+	}
+}
+
+func TestGetTopBirdsHandlerCapsLimit(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("TopBirds", maxTopLimit).Return([]*Bird{}, nil).Once()
+
+	req := httptest.NewRequest("GET", "/birds/top?limit=100000", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(srv).ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", recorder.Code, http.StatusOK)
+	}
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetFirstBirdHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("FindFirst", QueryOptions{Species: "sparrow"}).Return(&Bird{ID: 3, Species: "sparrow"}, nil).Once()
+	mockStore.On("FindFirst", QueryOptions{Species: "dodo"}).Return(nil, ErrBirdNotFound).Once()
+
+	router := newRouter(srv)
+
+	tests := []struct {
+		species        string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"sparrow", http.StatusOK, `{"id":3,"species":"sparrow","description":""`},
+		{"dodo", http.StatusNotFound, `{"error":"` + ErrBirdNotFound.Error() + `"}`},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird/first?species="+tt.species, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.species, status, tt.expectedStatus)
+		}
+		if !strings.HasPrefix(recorder.Body.String(), tt.expectedBody) {
+			t.Errorf("%s: handler returned unexpected body: got %v want %v",
+				tt.species, recorder.Body.String(), tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdByIDHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirdByID", 1).Return(&Bird{ID: 1, Species: "sparrow", Description: "A small harmless bird"}, nil).Once()
+	mockStore.On("IncrementViews", 1).Return(nil).Once()
+	mockStore.On("GetBirdByID", 2).Return(nil, ErrBirdNotFound).Once()
+
+	hf := http.HandlerFunc(srv.getBirdByIDHandler)
+
+	tests := []struct {
+		id             string
+		expectedStatus int
+	}{
+		{"1", http.StatusOK},
+		{"2", http.StatusNotFound},
+		{"sparrow", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird/"+tt.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("id %q: handler returned wrong status code: got %v want %v",
+				tt.id, status, tt.expectedStatus)
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+
+		bird := Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&bird); err != nil {
+			t.Fatal(err)
+		}
+		expected := Bird{ID: 1, Species: "sparrow", Description: "A small harmless bird"}
+		if bird != expected {
+			t.Errorf("handler returned unexpected body: got %v want %v", bird, expected)
+		}
+	}
+
+	// The bad ID should not have reached the store
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdByIDHandlerErrors(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirdByID", 2).Return(nil, ErrBirdNotFound).Once()
+	mockStore.On("GetBirdByID", 3).Return(nil, errors.New("connection refused")).Once()
+
+	hf := http.HandlerFunc(srv.getBirdByIDHandler)
+
+	tests := []struct {
+		id             string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"2", http.StatusNotFound, `{"error":"` + ErrBirdNotFound.Error() + `"}` + "\n"},
+		// The client gets a generic message, and not the database error
+		{"3", http.StatusInternalServerError, `{"error":"` + errInternal.Error() + `"}` + "\n"},
+		{"sparrow", http.StatusBadRequest, `{"error":"the bird ID must be a number"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird/"+tt.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("id %q: handler returned wrong status code: got %v want %v",
+				tt.id, status, tt.expectedStatus)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != jsonContentType() {
+			t.Errorf("id %q: handler returned wrong content type: got %q want %q", tt.id, contentType, jsonContentType())
+		}
+		if body := recorder.Body.String(); body != tt.expectedBody {
+			t.Errorf("id %q: handler returned unexpected body: got %q want %q", tt.id, body, tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetChecksumHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DatasetChecksum").Return("d41d8cd98f00b204e9800998ecf8427e", nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/checksum", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getChecksumHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	expected := `{"checksum":"d41d8cd98f00b204e9800998ecf8427e"}`
+	if actual := recorder.Body.String(); actual != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetMaxBirdIDHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("MaxBirdID").Return(42, nil).Once()
+
+	req, err := http.NewRequest("GET", "/birds/max-id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getMaxBirdIDHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	expected := `{"max_id":42}`
+	if actual := recorder.Body.String(); actual != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestGetBirdCountHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CountBirds").Return(42, nil).Once()
+	mockStore.On("CountBirds").Return(0, errors.New("connection refused")).Once()
+
+	router := newRouter(srv)
+
+	tests := []struct {
+		expectedStatus int
+		expectedBody   string
+	}{
+		{http.StatusOK, `{"count":42}`},
+		{http.StatusInternalServerError, `{"error":"` + errInternal.Error() + `"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird/count", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, tt.expectedStatus)
+		}
+		if actual := recorder.Body.String(); actual != tt.expectedBody {
+			t.Errorf("handler returned unexpected body: got %q want %q", actual, tt.expectedBody)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestUpdateBirdHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("UpdateBird", 1, &Bird{Species: "eagle", Description: "A bird of prey"}).Return(nil).Once()
+	mockStore.On("UpdateBird", 2, mock.Anything).Return(ErrBirdNotFound).Once()
+
+	hf := http.HandlerFunc(srv.updateBirdHandler)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{"success", "1", `{"species":"eagle","description":"A bird of prey"}`, http.StatusOK},
+		{"missing id", "2", `{"species":"eagle"}`, http.StatusNotFound},
+		{"malformed body", "1", `{"species":`, http.StatusBadRequest},
+		{"missing species", "1", `{"description":"A bird of prey"}`, http.StatusBadRequest},
+		{"bad id", "eagle", `{"species":"eagle"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("PUT", "/bird/"+tt.id, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		if tt.expectedStatus != http.StatusOK {
+			continue
+		}
+
+		bird := Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&bird); err != nil {
+			t.Fatal(err)
+		}
+		expected := Bird{ID: 1, Species: "eagle", Description: "A bird of prey"}
+		if bird != expected {
+			t.Errorf("handler returned unexpected body: got %v want %v", bird, expected)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestUpdateBirdHandlerDuplicateSpecies(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	violation := &pq.Error{Code: uniqueViolation, Message: `duplicate key value violates unique constraint "birds_species_key"`}
+	mockStore.On("UpdateBird", 1, &Bird{Species: "eagle"}).Return(violation).Once()
+
+	req, err := http.NewRequest("PUT", "/bird/1", strings.NewReader(`{"species":"eagle"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.updateBirdHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict)
+	}
+	expected := `{"error":"a bird of species \"eagle\" already exists"}` + "\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			recorder.Body.String(), expected)
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+// TestDuplicateSpeciesWithoutDatabase checks that the 409 doesn't depend on
+// the unique key of Postgres
+func TestDuplicateSpeciesWithoutDatabase(t *testing.T) {
+	router := newRouter(newServer(newMemStore()))
+
+	tests := []struct {
+		method, path, body string
+		expectedStatus     int
+	}{
+		{"POST", "/bird", `{"species":"eagle"}`, http.StatusCreated},
+		{"POST", "/bird", `{"species":"robin"}`, http.StatusCreated},
+		{"POST", "/bird", `{"species":"eagle"}`, http.StatusConflict},
+		{"POST", "/birds", `[{"species":"swift"},{"species":"robin"}]`, http.StatusConflict},
+		{"PUT", "/bird/2", `{"species":"eagle"}`, http.StatusConflict},
+		{"PATCH", "/bird/2", `{"species":"eagle"}`, http.StatusConflict},
+		// A bird keeping its own species is no conflict
+		{"PUT", "/bird/2", `{"species":"robin","description":"A red breast"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s %s %s: handler returned wrong status code: got %v want %v (%s)",
+				tt.method, tt.path, tt.body, status, tt.expectedStatus, recorder.Body.String())
+		}
+	}
+}
+
+func TestUpdateBirdHandlerVersion(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("UpdateBird", 1, &Bird{Species: "eagle", Version: 3}).Return(nil).Once()
+	mockStore.On("UpdateBird", 1, &Bird{Species: "eagle", Version: 2}).Return(ErrVersionConflict).Once()
+	mockStore.On("UpdateBird", 1, &Bird{Species: "eagle"}).Return(nil).Twice()
+
+	hf := http.HandlerFunc(srv.updateBirdHandler)
+
+	tests := []struct {
+		name           string
+		ifMatch        string
+		expectedStatus int
+	}{
+		{"current version", `"3"`, http.StatusOK},
+		{"stale version", `"2"`, http.StatusConflict},
+		// Without a version to check, the update goes through, as before
+		{"missing If-Match", "", http.StatusOK},
+		{"any version", "*", http.StatusOK},
+		{"malformed If-Match", `"abc"`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("PUT", "/bird/1", strings.NewReader(`{"species":"eagle"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+	}
+
+	// The malformed header should not have reached the store
+	mockStore.AssertExpectations(t)
+}
+
+func TestPatchBirdHandler(t *testing.T) {
+	eagle, description := "eagle", "A bird of prey"
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("PatchBird", 1, (*string)(nil), &description).Return(nil).Once()
+	mockStore.On("PatchBird", 1, &eagle, (*string)(nil)).Return(nil).Once()
+	mockStore.On("PatchBird", 2, mock.Anything, mock.Anything).Return(ErrBirdNotFound).Once()
+	mockStore.On("GetBirdByID", 1).Return(&Bird{ID: 1, Species: "eagle", Description: "A bird of prey"}, nil).Twice()
+
+	hf := http.HandlerFunc(srv.patchBirdHandler)
+
+	tests := []struct {
+		name           string
+		id             string
+		body           string
+		expectedStatus int
+	}{
+		{"description only", "1", `{"description":" A bird of prey "}`, http.StatusOK},
+		{"species only", "1", `{"species":"eagle"}`, http.StatusOK},
+		{"missing id", "2", `{"species":"eagle"}`, http.StatusNotFound},
+		{"empty patch", "1", `{}`, http.StatusBadRequest},
+		{"null fields", "1", `{"species":null,"description":null}`, http.StatusBadRequest},
+		{"malformed body", "1", `{"species":`, http.StatusBadRequest},
+		{"blank species", "1", `{"species":"  "}`, http.StatusUnprocessableEntity},
+		{"bad id", "eagle", `{"species":"eagle"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("PATCH", "/bird/"+tt.id, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.name, status, tt.expectedStatus)
+		}
+		if tt.expectedStatus != http.StatusOK {
+			continue
+		}
+
+		bird := Bird{}
+		if err := json.NewDecoder(recorder.Body).Decode(&bird); err != nil {
+			t.Fatal(err)
+		}
+		expected := Bird{ID: 1, Species: "eagle", Description: "A bird of prey"}
+		if bird != expected {
+			t.Errorf("%s: handler returned unexpected body: got %v want %v", tt.name, bird, expected)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestDeleteAllBirdsHandler(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.AdminToken = "admin-secret"
+
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteAllBirds").Return(nil).Once()
+	router := newRouter(srv)
+
+	tests := []struct {
+		query          string
+		authorization  string
+		expectedStatus int
+	}{
+		{"", "Bearer admin-secret", http.StatusBadRequest},
+		{"?confirm=false", "Bearer admin-secret", http.StatusBadRequest},
+		// Deleting every bird needs the admin token
+		{"?confirm=true", "", http.StatusUnauthorized},
+		{"?confirm=true", "Bearer not-the-secret", http.StatusUnauthorized},
+		{"?confirm=true", "Bearer admin-secret", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("DELETE", "/bird"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%q: handler returned wrong status code: got %v want %v",
+				tt.query, status, tt.expectedStatus)
+		}
+	}
+
+	// Only the confirmed request should have reached the store
+	mockStore.AssertExpectations(t)
+
+	// Without an admin token, deleting every bird is disabled
+	config.AdminToken = ""
+	req := httptest.NewRequest("DELETE", "/bird?confirm=true", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code without an admin token: got %v want %v", recorder.Code, http.StatusForbidden)
+	}
+}
+
+func TestDeleteBirdHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteBird", 1).Return(nil).Once()
+	mockStore.On("DeleteBird", 2).Return(ErrBirdNotFound).Once()
+
+	hf := http.HandlerFunc(srv.deleteBirdHandler)
+
+	tests := []struct {
+		id             string
+		expectedStatus int
+	}{
+		{"1", http.StatusNoContent},
+		{"2", http.StatusNotFound},
+		{"sparrow", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("DELETE", "/bird/"+tt.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("id %q: handler returned wrong status code: got %v want %v",
+				tt.id, status, tt.expectedStatus)
+		}
+	}
+
+	// The bad ID should not have reached the store
+	mockStore.AssertExpectations(t)
+}
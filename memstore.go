@@ -0,0 +1,612 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// memStore keeps the birds in memory, for running the application without a
+// database. Nothing survives a restart. Every request shares it, so the birds
+// are guarded by a mutex, and only copies of them are handed out
+type memStore struct {
+	mu     sync.RWMutex
+	birds  map[int]*Bird
+	views  map[int]int
+	nextID int
+}
+
+// newMemStore returns an empty store, whose first bird gets the ID 1
+func newMemStore() *memStore {
+	return &memStore{birds: map[int]*Bird{}, views: map[int]int{}, nextID: 1}
+}
+
+// sorted returns copies of the birds kept by `keep` (all of them when it is
+// nil), in the order of their IDs. The caller must hold the lock
+func (s *memStore) sorted(keep func(*Bird) bool) []*Bird {
+	birds := []*Bird{}
+	for _, bird := range s.birds {
+		if keep == nil || keep(bird) {
+			copied := *bird
+			birds = append(birds, &copied)
+		}
+	}
+	sort.Slice(birds, func(i, j int) bool { return birds[i].ID < birds[j].ID })
+	return birds
+}
+
+// insert stores a copy of `bird` with the next ID, and returns it. The caller
+// must hold the write lock
+func (s *memStore) insert(bird *Bird) *Bird {
+	now := time.Now()
+	stored := &Bird{ID: s.nextID, Species: bird.Species, Description: bird.Description, CreatedAt: now, UpdatedAt: now, Version: 1}
+	s.birds[s.nextID] = stored
+	s.nextID++
+	return stored
+}
+
+// speciesTaken tells if a bird other than the one with the ID `except` has
+// the `species`, which the unique key of the database would refuse. The caller
+// must hold the lock
+func (s *memStore) speciesTaken(species string, except int) bool {
+	for id, bird := range s.birds {
+		if id != except && bird.Species == species {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping always succeeds, since there is nothing to connect to
+func (s *memStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// SelfTest always succeeds, like `Ping`
+func (s *memStore) SelfTest(ctx context.Context) error {
+	return nil
+}
+
+func (s *memStore) CreateBird(ctx context.Context, bird *Bird) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.speciesTaken(bird.Species, 0) {
+		return ErrSpeciesExists
+	}
+	*bird = *s.insert(bird)
+	return nil
+}
+
+func (s *memStore) CreateBirds(ctx context.Context, birds []*Bird) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Like the database transaction, none of the birds are stored if one of
+	// their species is taken, or given twice
+	given := map[string]bool{}
+	for _, bird := range birds {
+		if given[bird.Species] || s.speciesTaken(bird.Species, 0) {
+			return ErrSpeciesExists
+		}
+		given[bird.Species] = true
+	}
+	for _, bird := range birds {
+		*bird = *s.insert(bird)
+	}
+	return nil
+}
+
+func (s *memStore) ImportBirds(ctx context.Context, birds []*Bird, strategy ConflictStrategy) ([]ImportOutcome, error) {
+	switch strategy {
+	case ConflictSkip, ConflictOverwrite, ConflictError:
+	default:
+		return nil, fmt.Errorf("unknown conflict strategy %q", strategy)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Nothing may change if the import fails, so every conflict is checked
+	// before the first bird is stored
+	if strategy == ConflictError {
+		for _, bird := range birds {
+			if _, ok := s.birds[bird.ID]; ok {
+				return nil, fmt.Errorf("bird %d: %w", bird.ID, ErrBirdExists)
+			}
+		}
+	}
+	if err := s.checkImportedSpecies(birds, strategy); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]ImportOutcome, len(birds))
+	for i, bird := range birds {
+		existing, ok := s.birds[bird.ID]
+		switch {
+		case bird.ID == 0:
+			s.insert(bird)
+			outcomes[i] = ImportCreated
+		case !ok:
+			now := time.Now()
+			s.birds[bird.ID] = &Bird{ID: bird.ID, Species: bird.Species, Description: bird.Description, CreatedAt: now, UpdatedAt: now, Version: 1}
+			outcomes[i] = ImportCreated
+		case strategy == ConflictSkip:
+			outcomes[i] = ImportSkipped
+		default:
+			existing.Species, existing.Description, existing.UpdatedAt = bird.Species, bird.Description, time.Now()
+			existing.Version++
+			outcomes[i] = ImportOverwritten
+		}
+		// Like the database sequence, the next ID goes past the imported ones
+		if bird.ID >= s.nextID {
+			s.nextID = bird.ID + 1
+		}
+	}
+	return outcomes, nil
+}
+
+// checkImportedSpecies tells if importing `birds` would leave two birds with
+// the same species, which the database refuses like an ID conflict. The caller
+// must hold the lock
+func (s *memStore) checkImportedSpecies(birds []*Bird, strategy ConflictStrategy) error {
+	speciesOf := map[int]string{}
+	for id, bird := range s.birds {
+		speciesOf[id] = bird.Species
+	}
+	for i, bird := range birds {
+		id := bird.ID
+		if id == 0 {
+			// The bird gets a new ID, that no other bird has
+			id = -(i + 1)
+		} else if _, ok := speciesOf[id]; ok && strategy == ConflictSkip {
+			continue
+		}
+		for other, species := range speciesOf {
+			if other != id && species == bird.Species {
+				return fmt.Errorf("bird %d: %w", bird.ID, ErrBirdExists)
+			}
+		}
+		speciesOf[id] = bird.Species
+	}
+	return nil
+}
+
+func (s *memStore) GetBirds(ctx context.Context) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(nil)
+	sort.SliceStable(birds, func(i, j int) bool {
+		if !birds[i].CreatedAt.Equal(birds[j].CreatedAt) {
+			return birds[i].CreatedAt.After(birds[j].CreatedAt)
+		}
+		return birds[i].ID > birds[j].ID
+	})
+	return birds, nil
+}
+
+func (s *memStore) CountBirds(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.birds), nil
+}
+
+func (s *memStore) MaxBirdID(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	max := 0
+	for id := range s.birds {
+		if id > max {
+			max = id
+		}
+	}
+	return max, nil
+}
+
+func (s *memStore) DatasetChecksum(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hash := md5.New()
+	for _, bird := range s.sorted(nil) {
+		row, err := json.Marshal([]interface{}{bird.ID, bird.Species, bird.Description, bird.CreatedAt, bird.UpdatedAt})
+		if err != nil {
+			return "", err
+		}
+		hash.Write(row)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *memStore) EachBird(ctx context.Context, fn func(*Bird) error) error {
+	// The birds are copied first, so that `fn` can use the store itself
+	s.mu.RLock()
+	birds := s.sorted(nil)
+	s.mu.RUnlock()
+	for _, bird := range birds {
+		if err := fn(bird); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) GetBirdsPage(ctx context.Context, limit, offset int) (*Page[Bird], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(nil)
+	total := len(birds)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return newPage(birds[offset:end], total, limit, offset), nil
+}
+
+func (s *memStore) GetBirdsPageWithFacets(ctx context.Context, opts QueryOptions, limit, offset int) (*FacetedPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(opts.matches)
+	facets := Facets{Species: map[string]int{}}
+	for _, bird := range birds {
+		facets.Species[bird.Species]++
+	}
+	total := len(birds)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return &FacetedPage{Page: newPage(birds[offset:end], total, limit, offset), Facets: facets}, nil
+}
+
+func (s *memStore) BirdsAfter(ctx context.Context, afterID, limit int) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool { return b.ID > afterID })
+	if len(birds) > limit {
+		birds = birds[:limit]
+	}
+	return birds, nil
+}
+
+func (s *memStore) GetBirdByID(ctx context.Context, id int) (*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bird, ok := s.birds[id]
+	if !ok {
+		return nil, ErrBirdNotFound
+	}
+	copied := *bird
+	return &copied, nil
+}
+
+// SchemaVersion is always the expected one, since there is no schema to keep
+// up to date
+func (s *memStore) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion, nil
+}
+
+func (s *memStore) FindFirst(ctx context.Context, opts QueryOptions) (*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(opts.matches)
+	if len(birds) == 0 {
+		return nil, ErrBirdNotFound
+	}
+	return birds[0], nil
+}
+
+func (s *memStore) UpdateColumns(ctx context.Context, id int, fields map[string]any) error {
+	for column := range fields {
+		if !updatableColumns[column] {
+			return fmt.Errorf("column %q can't be updated", column)
+		}
+		if _, ok := fields[column].(string); !ok {
+			return fmt.Errorf("column %q must be a string", column)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bird, ok := s.birds[id]
+	if !ok {
+		return ErrBirdNotFound
+	}
+	if species, ok := fields["species"]; ok {
+		if s.speciesTaken(species.(string), id) {
+			return ErrSpeciesExists
+		}
+		bird.Species = species.(string)
+	}
+	if description, ok := fields["description"]; ok {
+		bird.Description = description.(string)
+	}
+	bird.UpdatedAt = time.Now()
+	bird.Version++
+	return nil
+}
+
+func (s *memStore) UpdateBird(ctx context.Context, id int, bird *Bird) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.birds[id]
+	if !ok {
+		return ErrBirdNotFound
+	}
+	if bird.Version != 0 && bird.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if s.speciesTaken(bird.Species, id) {
+		return ErrSpeciesExists
+	}
+	existing.Species, existing.Description, existing.UpdatedAt = bird.Species, bird.Description, time.Now()
+	existing.Version++
+	*bird = *existing
+	return nil
+}
+
+func (s *memStore) PatchBird(ctx context.Context, id int, species, description *string) error {
+	fields := patchColumns(species, description)
+	if len(fields) == 0 {
+		return errEmptyPatch
+	}
+	return s.UpdateColumns(ctx, id, fields)
+}
+
+func (s *memStore) IncrementViews(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.birds[id]; !ok {
+		return ErrBirdNotFound
+	}
+	s.views[id]++
+	return nil
+}
+
+func (s *memStore) DeleteBird(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.birds[id]; !ok {
+		return ErrBirdNotFound
+	}
+	delete(s.birds, id)
+	delete(s.views, id)
+	return nil
+}
+
+func (s *memStore) DeleteAllBirds(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.birds, s.views = map[int]*Bird{}, map[int]int{}
+	return nil
+}
+
+func (s *memStore) DeleteBirdsMatching(ctx context.Context, opts QueryOptions) (int, error) {
+	if opts.isEmpty() {
+		return 0, errEmptyFilter
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for id, bird := range s.birds {
+		if opts.matches(bird) {
+			delete(s.birds, id)
+			delete(s.views, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memStore) ReplaceDescription(ctx context.Context, placeholder, replacement string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updated := 0
+	for _, bird := range s.birds {
+		if bird.Description == placeholder {
+			bird.Description, bird.UpdatedAt = replacement, time.Now()
+			bird.Version++
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// newest sorts the birds by `at`, newest first (and by ID when they are
+// equal), and keeps the first `limit` of them
+func newest(birds []*Bird, at func(*Bird) time.Time, limit int) []*Bird {
+	sort.SliceStable(birds, func(i, j int) bool {
+		if !at(birds[i]).Equal(at(birds[j])) {
+			return at(birds[i]).After(at(birds[j]))
+		}
+		return birds[i].ID > birds[j].ID
+	})
+	if len(birds) > limit {
+		birds = birds[:limit]
+	}
+	return birds
+}
+
+func (s *memStore) RecentBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newest(s.sorted(nil), func(b *Bird) time.Time { return b.CreatedAt }, limit), nil
+}
+
+func (s *memStore) RecentlyUpdated(ctx context.Context, limit int) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newest(s.sorted(nil), func(b *Bird) time.Time { return b.UpdatedAt }, limit), nil
+}
+
+func (s *memStore) TopBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(nil)
+	sort.SliceStable(birds, func(i, j int) bool { return s.views[birds[i].ID] > s.views[birds[j].ID] })
+	if len(birds) > limit {
+		birds = birds[:limit]
+	}
+	return birds, nil
+}
+
+func (s *memStore) FirstAndLastBird(ctx context.Context) (first, last *Bird, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := newest(s.sorted(nil), func(b *Bird) time.Time { return b.CreatedAt }, len(s.birds))
+	if len(birds) == 0 {
+		return nil, nil, nil
+	}
+	return birds[len(birds)-1], birds[0], nil
+}
+
+func (s *memStore) CountsByDay(ctx context.Context, from, to time.Time) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := map[string]int{}
+	for _, bird := range s.birds {
+		if !bird.CreatedAt.Before(from) && bird.CreatedAt.Before(to) {
+			counts[bird.CreatedAt.UTC().Format("2006-01-02")]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memStore) BirdsByInitial(ctx context.Context, letter string) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool {
+		return strings.HasPrefix(strings.ToLower(b.Species), strings.ToLower(letter))
+	})
+	sort.SliceStable(birds, func(i, j int) bool { return birds[i].Species < birds[j].Species })
+	return birds, nil
+}
+
+func (s *memStore) FindBirdsBySpecies(ctx context.Context, name string) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool {
+		return strings.Contains(strings.ToLower(b.Species), strings.ToLower(name))
+	})
+	sort.SliceStable(birds, func(i, j int) bool { return birds[i].Species < birds[j].Species })
+	return birds, nil
+}
+
+func (s *memStore) SearchBirds(ctx context.Context, species, descKeyword string) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool {
+		return strings.Contains(strings.ToLower(b.Species), strings.ToLower(species)) &&
+			strings.Contains(strings.ToLower(b.Description), strings.ToLower(descKeyword))
+	})
+	sort.SliceStable(birds, func(i, j int) bool { return birds[i].Species < birds[j].Species })
+	return birds, nil
+}
+
+func (s *memStore) BirdsBySpeciesList(ctx context.Context, species []string) ([]*Bird, error) {
+	wanted := map[string]bool{}
+	for _, name := range species {
+		wanted[name] = true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(func(b *Bird) bool { return wanted[b.Species] }), nil
+}
+
+func (s *memStore) SpeciesInitials(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := map[string]bool{}
+	var initials []string
+	for _, bird := range s.birds {
+		if bird.Species == "" {
+			continue
+		}
+		first, _ := utf8.DecodeRuneInString(bird.Species)
+		initial := strings.ToUpper(string(first))
+		if !seen[initial] {
+			seen[initial] = true
+			initials = append(initials, initial)
+		}
+	}
+	sort.Strings(initials)
+	return initials, nil
+}
+
+func (s *memStore) SpeciesCounts(ctx context.Context) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := map[string]int{}
+	for _, bird := range s.birds {
+		counts[bird.Species]++
+	}
+	return counts, nil
+}
+
+func (s *memStore) BirdsByDescriptionLength(ctx context.Context, min, max int) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(func(b *Bird) bool {
+		n := utf8.RuneCountInString(b.Description)
+		return n >= min && n <= max
+	}), nil
+}
+
+func (s *memStore) BirdsMissingDescription(ctx context.Context) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(func(b *Bird) bool { return b.Description == "" }), nil
+}
+
+func (s *memStore) BirdsModifiedSince(ctx context.Context, t time.Time) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool { return b.UpdatedAt.After(t) })
+	sort.SliceStable(birds, func(i, j int) bool { return birds[i].UpdatedAt.Before(birds[j].UpdatedAt) })
+	return birds, nil
+}
+
+func (s *memStore) StaleBirds(ctx context.Context, before time.Time) ([]*Bird, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	birds := s.sorted(func(b *Bird) bool { return b.UpdatedAt.Before(before) })
+	sort.SliceStable(birds, func(i, j int) bool { return birds[i].UpdatedAt.Before(birds[j].UpdatedAt) })
+	return birds, nil
+}
+
+// FullTextSearch has no stemming in memory: like plainto_tsquery, it matches
+// the birds whose description contains every word of the query, ignoring case
+// and punctuation. Single letters (the "s" of "bird's") are stop words to
+// postgres, and are skipped too
+func (s *memStore) FullTextSearch(ctx context.Context, query string) ([]*Bird, error) {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if utf8.RuneCountInString(word) > 1 {
+			words = append(words, word)
+		}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sorted(func(b *Bird) bool {
+		description := strings.ToLower(b.Description)
+		for _, word := range words {
+			if !strings.Contains(description, word) {
+				return false
+			}
+		}
+		return len(words) > 0
+	}), nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{{Species: "sparrow"}, {Species: "eagle", Description: "A bird of prey"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	bird, err := s.GetBirdByID(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bird.Species != "eagle" || bird.CreatedAt.IsZero() {
+		t.Errorf("unexpected bird: %+v", bird)
+	}
+
+	// The birds handed out are copies, which can't change the stored ones
+	bird.Species = "changed"
+	if stored, _ := s.GetBirdByID(ctx, 2); stored.Species != "eagle" {
+		t.Errorf("the stored bird was changed through a copy: %+v", stored)
+	}
+
+	update := &Bird{Species: "golden eagle"}
+	if err := s.UpdateBird(ctx, 2, update); err != nil {
+		t.Fatal(err)
+	}
+	if update.ID != 2 || update.CreatedAt.IsZero() {
+		t.Errorf("the updated bird should be filled in, got %+v", update)
+	}
+	if err := s.UpdateColumns(ctx, 2, map[string]any{"created_at": "2019-01-01"}); err == nil {
+		t.Errorf("expected an error when updating created_at")
+	}
+
+	if err := s.DeleteBird(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBirdByID(ctx, 1); err != ErrBirdNotFound {
+		t.Errorf("expected ErrBirdNotFound for a deleted bird, got %v", err)
+	}
+	if err := s.DeleteBird(ctx, 1); err != ErrBirdNotFound {
+		t.Errorf("expected ErrBirdNotFound when deleting twice, got %v", err)
+	}
+
+	// IDs aren't reused after a delete
+	if err := s.CreateBird(ctx, &Bird{Species: "robin"}); err != nil {
+		t.Fatal(err)
+	}
+	birds, err := s.GetBirds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].ID != 3 || birds[1].ID != 2 {
+		t.Errorf("unexpected birds: %+v", birds)
+	}
+}
+
+func TestMemStoreImportBirds(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBird(ctx, &Bird{Species: "sparrow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A conflict fails the whole import, without changing anything
+	_, err := s.ImportBirds(ctx, []*Bird{{ID: 5, Species: "eagle"}, {ID: 1, Species: "robin"}}, ConflictError)
+	if !errors.Is(err, ErrBirdExists) {
+		t.Errorf("expected ErrBirdExists, got %v", err)
+	}
+	if count, _ := s.CountBirds(ctx); count != 1 {
+		t.Errorf("a failed import should not create birds, got %d", count)
+	}
+
+	outcomes, err := s.ImportBirds(ctx, []*Bird{{ID: 5, Species: "eagle"}, {ID: 1, Species: "robin"}}, ConflictOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcomes[0] != ImportCreated || outcomes[1] != ImportOverwritten {
+		t.Errorf("unexpected outcomes: %v", outcomes)
+	}
+
+	// New birds are given IDs after the imported ones
+	if err := s.CreateBird(ctx, &Bird{Species: "owl"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBirdByID(ctx, 6); err != nil {
+		t.Errorf("the next bird should have ID 6: %v", err)
+	}
+}
+
+func TestMemStoreUniqueSpecies(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{{Species: "sparrow"}, {Species: "eagle"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreateBird(ctx, &Bird{Species: "eagle"}); err != ErrSpeciesExists {
+		t.Errorf("expected ErrSpeciesExists when creating a species twice, got %v", err)
+	}
+	if err := s.UpdateBird(ctx, 1, &Bird{Species: "eagle"}); err != ErrSpeciesExists {
+		t.Errorf("expected ErrSpeciesExists when updating to a taken species, got %v", err)
+	}
+	if err := s.UpdateColumns(ctx, 1, map[string]any{"species": "eagle"}); err != ErrSpeciesExists {
+		t.Errorf("expected ErrSpeciesExists when patching to a taken species, got %v", err)
+	}
+	// Keeping its own species is fine
+	if err := s.UpdateBird(ctx, 2, &Bird{Species: "eagle", Description: "A bird of prey"}); err != nil {
+		t.Errorf("a bird should be able to keep its species, got %v", err)
+	}
+
+	// A batch is stored whole or not at all, whether a species is taken or
+	// given twice
+	for _, batch := range [][]*Bird{
+		{{Species: "robin"}, {Species: "sparrow"}},
+		{{Species: "robin"}, {Species: "robin"}},
+	} {
+		if err := s.CreateBirds(ctx, batch); err != ErrSpeciesExists {
+			t.Errorf("expected ErrSpeciesExists for the batch, got %v", err)
+		}
+	}
+	if count, _ := s.CountBirds(ctx); count != 2 {
+		t.Errorf("the refused birds should not be stored, got %d birds", count)
+	}
+
+	// Imports are refused like an ID conflict, and change nothing
+	_, err := s.ImportBirds(ctx, []*Bird{{ID: 5, Species: "robin"}, {ID: 6, Species: "sparrow"}}, ConflictSkip)
+	if !errors.Is(err, ErrBirdExists) {
+		t.Errorf("expected ErrBirdExists when importing a taken species, got %v", err)
+	}
+	if count, _ := s.CountBirds(ctx); count != 2 {
+		t.Errorf("a failed import should not create birds, got %d", count)
+	}
+	// Overwriting a bird frees its old species for the rest of the import
+	if _, err := s.ImportBirds(ctx, []*Bird{{ID: 1, Species: "robin"}, {Species: "sparrow"}}, ConflictOverwrite); err != nil {
+		t.Errorf("expected the import to succeed, got %v", err)
+	}
+}
+
+func TestMemStoreUpdateBirdVersion(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBird(ctx, &Bird{Species: "sparrow"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every change moves the version on...
+	bird := &Bird{Species: "robin", Version: 1}
+	if err := s.UpdateBird(ctx, 1, bird); err != nil {
+		t.Fatal(err)
+	}
+	if bird.Version != 2 {
+		t.Errorf("expected version 2 after an update, got %d", bird.Version)
+	}
+	if err := s.UpdateColumns(ctx, 1, map[string]any{"description": "A songbird"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...so that an update based on an older version is refused
+	if err := s.UpdateBird(ctx, 1, &Bird{Species: "eagle", Version: 2}); err != ErrVersionConflict {
+		t.Errorf("expected ErrVersionConflict, got %v", err)
+	}
+	if stored, _ := s.GetBirdByID(ctx, 1); stored.Species != "robin" || stored.Version != 3 {
+		t.Errorf("the conflicting update should not be stored: %+v", stored)
+	}
+	if err := s.UpdateBird(ctx, 2, &Bird{Species: "eagle", Version: 1}); err != ErrBirdNotFound {
+		t.Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func TestMemStoreDeleteAllBirds(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{{Species: "sparrow"}, {Species: "eagle"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteAllBirds(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.CountBirds(ctx); count != 0 {
+		t.Errorf("expected no birds left, got %d", count)
+	}
+	// IDs aren't reused, like after a single delete
+	if err := s.CreateBird(ctx, &Bird{Species: "robin"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetBirdByID(ctx, 3); err != nil {
+		t.Errorf("the next bird should have ID 3: %v", err)
+	}
+}
+
+func TestMemStoreFullTextSearch(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{
+		{Species: "wren", Description: "A small brown bird"},
+		{Species: "eagle", Description: "A large bird of prey"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, want := range map[string]int{
+		"bird":        2,
+		"small bird":  1,
+		"bird's":      2,
+		"small & big": 0,
+		"!!":          0,
+	} {
+		birds, err := s.FullTextSearch(ctx, query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if len(birds) != want {
+			t.Errorf("%q: wanted %d birds, got %d", query, want, len(birds))
+		}
+	}
+}
+
+func TestMemStoreGetBirdsNewestFirst(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBirds(ctx, []*Bird{{Species: "middle"}, {Species: "newest"}, {Species: "oldest"}, {Species: "batch"}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.birds[1].CreatedAt = now.Add(-time.Hour)
+	s.birds[2].CreatedAt = now
+	s.birds[3].CreatedAt = now.Add(-2 * time.Hour)
+	// Birds created at the same time come by descending ID
+	s.birds[4].CreatedAt = now.Add(-time.Hour)
+
+	birds, err := s.GetBirds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	species := []string{}
+	for _, bird := range birds {
+		species = append(species, bird.Species)
+	}
+	if strings.Join(species, ",") != "newest,batch,middle,oldest" {
+		t.Errorf("expected the newest birds first, got %v", species)
+	}
+}
+
+// TestMemStoreConcurrentAccess is meant to be run with `-race`, which reports
+// any access to the birds that isn't guarded by the mutex
+func TestMemStoreConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	const workers, birdsPerWorker = 8, 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < birdsPerWorker; i++ {
+				if err := s.CreateBird(ctx, &Bird{Species: "bird " + strconv.Itoa(w) + "-" + strconv.Itoa(i), Description: "placeholder"}); err != nil {
+					t.Error(err)
+					return
+				}
+				s.GetBirds(ctx)
+				s.GetBirdsPage(ctx, 10, i)
+				s.UpdateColumns(ctx, i+1, map[string]any{"description": "updated"})
+				s.ReplaceDescription(ctx, "placeholder", "replaced")
+				s.RecentlyUpdated(ctx, 5)
+				s.DatasetChecksum(ctx)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Every bird was created once, with an ID of its own
+	birds, err := s.GetBirds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(birds) != workers*birdsPerWorker {
+		t.Fatalf("expected %d birds, got %d", workers*birdsPerWorker, len(birds))
+	}
+	for i, bird := range birds {
+		if bird.ID != len(birds)-i {
+			t.Fatalf("expected the IDs to follow each other, got %d at %d", bird.ID, i)
+		}
+	}
+}
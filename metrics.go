@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The metrics of the API, scraped by Prometheus from `GET /metrics`. They are
+// recorded by `loggingMiddleware`, so that every request is counted, including
+// the ones turned away by the other middlewares
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests served, by method and response status.",
+	}, []string{"method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "How long HTTP requests took to serve, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+// observeRequest records a request that was served with `status`
+func observeRequest(method string, status int, duration time.Duration) {
+	method = methodLabel(method)
+	httpRequestsTotal.WithLabelValues(method, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// methodLabel is the `method` label of a request. Clients can send any
+// method they like, and each label value is a series of its own, so the
+// methods that aren't standard are all counted as "OTHER"
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
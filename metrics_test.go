@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeCounter fetches `/metrics` from the router, and returns the value of
+// the `series`, such as `http_requests_total{method="GET",status="200"}`. A
+// series that wasn't recorded yet is 0
+func scrapeCounter(t *testing.T, router http.Handler, series string) float64 {
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("/metrics returned wrong status code: got %v want %v", recorder.Code, http.StatusOK)
+	}
+
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), series+" "); ok {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	mockStore := InitMockStore()
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	router := newRouter(newServer(mockStore))
+	// The requests are counted by the logging middleware. The scrapes aren't,
+	// since they go straight to the router
+	h := loggingMiddleware(router)
+
+	const series = `http_requests_total{method="GET",status="200"}`
+	before := scrapeCounter(t, router, series)
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", "/bird", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if after := scrapeCounter(t, router, series); after != before+3 {
+		t.Errorf("expected the counter to go from %v to %v, got %v", before, before+3, after)
+	}
+	if duration := scrapeCounter(t, router, `http_request_duration_seconds_count{method="GET"}`); duration < 3 {
+		t.Errorf("expected the durations of at least 3 requests, got %v", duration)
+	}
+}
+
+func TestMetricsMethodLabel(t *testing.T) {
+	router := newRouter(newServer(InitMockStore()))
+	h := loggingMiddleware(router)
+
+	// Made up methods all share a single series
+	const series = `http_requests_total{method="OTHER",status="405"}`
+	before := scrapeCounter(t, router, series)
+	for _, method := range []string{"FOO", "BAR"} {
+		req := httptest.NewRequest(method, "/bird", nil)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if after := scrapeCounter(t, router, series); after != before+2 {
+		t.Errorf("expected the counter to go from %v to %v, got %v", before, before+2, after)
+	}
+	if n := scrapeCounter(t, router, `http_requests_total{method="FOO",status="405"}`); n != 0 {
+		t.Errorf("expected no series for the FOO method, got %v", n)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ready is flipped to true by `main` once startup (including initialising the
+// store) has finished. Until then there is nothing useful the handlers can do,
+// so the readiness gate turns requests away with a 503 instead of letting them
+// fail in more confusing ways
+var ready atomic.Bool
+
+func setReady(r bool) {
+	ready.Store(r)
+}
+
+// healthPaths are the health check routes, which must keep answering while the
+// application is starting up, so that orchestrators can follow its progress
+var healthPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// readinessMiddleware responds with 503 Service Unavailable to every request
+// other than the health checks, until the application has been marked as ready
+func readinessMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() && !healthPaths[r.URL.Path] {
+			w.Header().Set("Retry-After", "1")
+			writeJSONError(w, http.StatusServiceUnavailable, "service is starting up")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentAPIVersion is the version of the payloads that the handlers produce
+// when the client doesn't ask for a particular one
+const currentAPIVersion = "1"
+
+// apiVersions lists the payload versions clients can pin with the
+// `Accept-Version` header, and whether they can be served yet. Version 2 is
+// reserved for the next incompatible change to the bird payloads
+var apiVersions = map[string]bool{
+	"1": true,
+	"2": false,
+}
+
+// apiVersionMiddleware negotiates the payload version of an API handler. The
+// version is taken from the `Accept-Version` request header ("1" or "v1"),
+// and echoed back in the `X-API-Version` response header
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := strings.TrimPrefix(strings.ToLower(r.Header.Get("Accept-Version")), "v")
+		if version == "" {
+			version = currentAPIVersion
+		}
+
+		supported, known := apiVersions[version]
+		if !known {
+			writeJSONError(w, http.StatusBadRequest, "unknown API version "+version)
+			return
+		}
+		if !supported {
+			writeJSONError(w, http.StatusBadRequest, "API version "+version+" is not available yet")
+			return
+		}
+
+		w.Header().Set("X-API-Version", version)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptCharsetMiddleware responds with 406 Not Acceptable to clients whose
+// `Accept-Charset` header rules out UTF-8, which is the only charset our
+// responses are written in
+func acceptCharsetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Accept-Charset"); header != "" && !acceptsUTF8(header) {
+			writeJSONError(w, http.StatusNotAcceptable, "responses are only available in utf-8")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptsUTF8 tells if an `Accept-Charset` header value, such as
+// "iso-8859-1, utf-8;q=0.5", allows UTF-8
+func acceptsUTF8(header string) bool {
+	return headerAccepts(header, "utf-8")
+}
+
+// headerAccepts tells if the value of a header listing what the client
+// accepts with qualities, such as `Accept-Charset` or `Accept-Encoding`,
+// allows `value`. A value that isn't listed is unacceptable, unless the `*`
+// wildcard is, and a quality of 0 rules it out
+func headerAccepts(header, value string) bool {
+	valueQ, wildcardQ := -1.0, -1.0
+	for _, entry := range strings.Split(header, ",") {
+		params := strings.Split(entry, ";")
+		q := 1.0
+		for _, param := range params[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(params[0])) {
+		case value:
+			valueQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	// The value being listed takes precedence over the wildcard
+	if valueQ >= 0 {
+		return valueQ > 0
+	}
+	return wildcardQ > 0
+}
+
+// maxQueryParamsMiddleware responds with 400 Bad Request to requests with more
+// than `max` query parameters. They are counted in the raw query, so that an
+// abusive query string is turned away before anything parses it
+func maxQueryParamsMiddleware(max int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := 0
+		for _, param := range strings.Split(r.URL.RawQuery, "&") {
+			if param != "" {
+				count++
+			}
+		}
+		if count > max {
+			writeJSONError(w, http.StatusBadRequest, "too many query parameters, the limit is "+strconv.Itoa(max))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canonicalHostMiddleware redirects requests for any other host than `host`
+// (such as "www.example.com" instead of "example.com") to the same path and
+// query on `host`, with 301 Moved Permanently, so that all the traffic ends
+// up on a single hostname. The health checks are answered on any host, since
+// orchestrators call them by IP address
+func canonicalHostMiddleware(host string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Host, host) || healthPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		http.Redirect(w, r, requestScheme(r)+"://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// hstsMiddleware tells browsers to only ever reach us over HTTPS, with the
+// `Strict-Transport-Security` header. The header is ignored by browsers on
+// plain HTTP responses, so it is only set on HTTPS ones
+func hstsMiddleware(maxAge int, includeSubdomains bool, next http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(maxAge)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHTTPS(r) {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isHTTPS tells if the client made the request over HTTPS, either to us, or to
+// a trusted proxy that reports it in `X-Forwarded-Proto`
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	return isTrustedProxy(peer) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// requestScheme is "https" for the requests made over HTTPS (see `isHTTPS`),
+// and "http" for the others
+func requestScheme(r *http.Request) string {
+	if isHTTPS(r) {
+		return "https"
+	}
+	return "http"
+}
+
+// slowRequestMiddleware logs a warning for the requests that take longer than
+// `threshold` to serve, with their route and how long they took. It is a `mux`
+// middleware, so that requests are grouped by their path template, such as
+// "/bird/{id}", rather than by their actual path
+func slowRequestMiddleware(threshold time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		took := time.Since(start)
+		if took <= threshold {
+			return
+		}
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		log.Printf("WARN slow request: %s %s took %v", r.Method, logValue(route), took)
+	})
+}
+
+// overridableMethods are the methods that a POST can be turned into with the
+// `X-HTTP-Method-Override` header. GET and HEAD are left out, since a POST
+// must not be answered as if it were safe to repeat
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// methodOverrideMiddleware dispatches a POST with the `X-HTTP-Method-Override`
+// header as the method of the header, for clients and proxies that can't send
+// anything but GET and POST. Overrides to other methods are refused with a 400
+func methodOverrideMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := strings.ToUpper(strings.TrimSpace(r.Header.Get("X-HTTP-Method-Override")))
+		if r.Method != http.MethodPost || override == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !overridableMethods[override] {
+			writeJSONError(w, http.StatusBadRequest, "X-HTTP-Method-Override must be PUT, PATCH or DELETE")
+			return
+		}
+		r.Method = override
+		r.Header.Del("X-HTTP-Method-Override")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverMiddleware turns a panic in a handler into a 500 for its client, and
+// logs it with the stack trace, rather than letting a single bad request take
+// down the whole server. `http.ErrAbortHandler` is panicked on again, since it
+// is how handlers ask `net/http` to drop the connection on purpose
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			log.Printf("ERROR panic serving %s %s: %v\n%s", r.Method, logValue(r.URL.Path), err, debug.Stack())
+			writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
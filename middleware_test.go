@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestReadinessMiddleware(t *testing.T) {
+	// Put the gate in front of the actual router, the same way `main` does
+	defer setReady(ready.Load())
+	setReady(false)
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	mockServer := httptest.NewServer(readinessMiddleware(newRouter(srv)))
+	defer mockServer.Close()
+
+	// Before the application is ready, requests should be turned away
+	resp, err := http.Get(mockServer.URL + "/bird")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Status should be 503, got %d", resp.StatusCode)
+	}
+
+	// Once startup has completed, the same request should go through
+	setReady(true)
+	resp, err = http.Get(mockServer.URL + "/bird")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status should be 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{}, nil)
+	r := newRouter(srv)
+	mockServer := httptest.NewServer(r)
+	defer mockServer.Close()
+
+	// Each case sends a different `Accept-Version` header to the bird API
+	tests := []struct {
+		acceptVersion string
+		status        int
+		apiVersion    string
+	}{
+		{"", http.StatusOK, "1"},
+		{"1", http.StatusOK, "1"},
+		{"v1", http.StatusOK, "1"},
+		{"2", http.StatusBadRequest, ""},
+		{"v7", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", mockServer.URL+"/bird", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.acceptVersion != "" {
+			req.Header.Set("Accept-Version", tt.acceptVersion)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("Accept-Version %q: status should be %d, got %d", tt.acceptVersion, tt.status, resp.StatusCode)
+		}
+		if v := resp.Header.Get("X-API-Version"); v != tt.apiVersion {
+			t.Errorf("Accept-Version %q: X-API-Version should be %q, got %q", tt.acceptVersion, tt.apiVersion, v)
+		}
+	}
+}
+
+func TestAcceptCharsetMiddleware(t *testing.T) {
+	hf := acceptCharsetMiddleware(http.HandlerFunc(handler))
+
+	tests := []struct {
+		acceptCharset  string
+		expectedStatus int
+	}{
+		{"", http.StatusOK},
+		{"utf-8", http.StatusOK},
+		{"iso-8859-1, UTF-8;q=0.5", http.StatusOK},
+		{"*", http.StatusOK},
+		{"iso-8859-1", http.StatusNotAcceptable},
+		{"utf-8;q=0", http.StatusNotAcceptable},
+		{"*, utf-8;q=0", http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/hello", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.acceptCharset != "" {
+			req.Header.Set("Accept-Charset", tt.acceptCharset)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("Accept-Charset %q: handler returned wrong status code: got %v want %v",
+				tt.acceptCharset, status, tt.expectedStatus)
+		}
+	}
+}
+
+func TestMaxQueryParamsMiddleware(t *testing.T) {
+	hf := maxQueryParamsMiddleware(3, http.HandlerFunc(handler))
+
+	tests := []struct {
+		query          string
+		expectedStatus int
+	}{
+		{"", http.StatusOK},
+		{"a=1&b=2&a=3", http.StatusOK},
+		{"a=1&b=2&c=3&d=4", http.StatusBadRequest},
+		{strings.Repeat("a=1&", 1000), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/hello?"+tt.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("query %.20q: handler returned wrong status code: got %v want %v",
+				tt.query, status, tt.expectedStatus)
+		}
+	}
+}
+
+func TestCanonicalHostMiddleware(t *testing.T) {
+	hf := canonicalHostMiddleware("birds.example.com", http.HandlerFunc(handler))
+
+	tests := []struct {
+		host             string
+		path             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"birds.example.com", "/hello", http.StatusOK, ""},
+		{"BIRDS.example.com", "/hello", http.StatusOK, ""},
+		{"www.birds.example.com", "/hello?name=sparrow", http.StatusMovedPermanently, "http://birds.example.com/hello?name=sparrow"},
+		{"10.0.0.1:8080", "/readyz", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = tt.host
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s%s: handler returned wrong status code: got %v want %v",
+				tt.host, tt.path, status, tt.expectedStatus)
+		}
+		if location := recorder.Header().Get("Location"); location != tt.expectedLocation {
+			t.Errorf("%s%s: wrong redirect: got %q want %q", tt.host, tt.path, location, tt.expectedLocation)
+		}
+	}
+}
+
+func TestHSTSMiddleware(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	nets, err := parseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TrustedProxies = nets
+
+	hf := hstsMiddleware(31536000, true, http.HandlerFunc(handler))
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		tls            bool
+		forwardedProto string
+		expectedHSTS   string
+	}{
+		{"https", "203.0.113.7:5123", true, "", "max-age=31536000; includeSubDomains"},
+		{"plain http", "203.0.113.7:5123", false, "", ""},
+		{"https at a trusted proxy", "10.1.2.3:80", false, "https", "max-age=31536000; includeSubDomains"},
+		{"spoofed by an untrusted peer", "203.0.113.7:5123", false, "https", ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/hello", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = tt.remoteAddr
+		if tt.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if tt.forwardedProto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.forwardedProto)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if hsts := recorder.Header().Get("Strict-Transport-Security"); hsts != tt.expectedHSTS {
+			t.Errorf("%s: wrong Strict-Transport-Security: got %q want %q", tt.name, hsts, tt.expectedHSTS)
+		}
+	}
+}
+
+func TestSlowRequestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	r.HandleFunc("/hello", handler)
+	r.Use(func(next http.Handler) http.Handler {
+		return slowRequestMiddleware(10*time.Millisecond, next)
+	})
+
+	for _, path := range []string{"/hello", "/slow/1"} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Only the slow request is logged, by its route rather than its path
+	if lines := strings.Count(logs.String(), "\n"); lines != 1 {
+		t.Errorf("expected a single warning, got %q", logs.String())
+	}
+	if !strings.Contains(logs.String(), "WARN slow request: GET /slow/{id} took ") {
+		t.Errorf("expected a warning for the slow route, got %q", logs.String())
+	}
+}
+
+func TestMethodOverrideMiddleware(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("DeleteBird", 1).Return(nil).Once()
+	mockStore.On("GetBirdByID", 1).Return(nil, ErrBirdNotFound).Once()
+
+	h := methodOverrideMiddleware(newRouter(srv))
+
+	tests := []struct {
+		method         string
+		override       string
+		expectedStatus int
+	}{
+		// The POST is dispatched to the delete handler...
+		{"POST", "DELETE", http.StatusNoContent},
+		// ...but can't be turned into a safe method...
+		{"POST", "GET", http.StatusBadRequest},
+		// ...and only a POST can be overridden, so this is still a GET
+		{"GET", "DELETE", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, "/bird/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-HTTP-Method-Override", tt.override)
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s overridden to %s: wrong status code: got %v want %v",
+				tt.method, tt.override, status, tt.expectedStatus)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var bird *Bird
+		w.Write([]byte(bird.Species))
+	})
+	r.HandleFunc("/hello", handler)
+	mockServer := httptest.NewServer(recoverMiddleware(r))
+	defer mockServer.Close()
+
+	// The client of the bad handler gets a clean error...
+	resp, err := http.Get(mockServer.URL + "/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusInternalServerError)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["error"] != errInternal.Error() {
+		t.Errorf("expected the internal error, got %v", body)
+	}
+	if !strings.Contains(logs.String(), "panic serving GET /panic: runtime error") || !strings.Contains(logs.String(), "goroutine") {
+		t.Errorf("expected the panic to be logged with its stack, got %q", logs.String())
+	}
+
+	// ...and the server keeps serving the other requests
+	resp, err = http.Get(mockServer.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the server to still be up, got %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import "net/http"
+
+// The types below are the parts of an OpenAPI 3.0 document that we use. They
+// are built in Go, rather than kept as a JSON file, so that the compiler
+// catches a document that no longer fits together
+
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       openAPIInfo                            `json:"info"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components openAPIComponents                      `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string        `json:"name"`
+	In       string        `json:"in"`
+	Required bool          `json:"required"`
+	Schema   openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref        string                   `json:"$ref,omitempty"`
+	Type       string                   `json:"type,omitempty"`
+	Format     string                   `json:"format,omitempty"`
+	Properties map[string]openAPISchema `json:"properties,omitempty"`
+	Required   []string                 `json:"required,omitempty"`
+	Items      *openAPISchema           `json:"items,omitempty"`
+	MaxLength  int                      `json:"maxLength,omitempty"`
+	ReadOnly   bool                     `json:"readOnly,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]openAPISchema `json:"schemas"`
+}
+
+// openAPIVersion is the version of the API described by the document, which
+// is bumped along with any change to it
+const openAPIVersion = "1.0.0"
+
+// jsonContent describes a JSON body matching `schema`
+func jsonContent(schema openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+// openAPISpec describes the main endpoints of the API. The limits on the
+// fields of a bird follow the configuration, like the validation does
+func openAPISpec() openAPIDocument {
+	bird := openAPISchema{Ref: "#/components/schemas/Bird"}
+	birdError := openAPIResponse{Description: "The error", Content: jsonContent(openAPISchema{Ref: "#/components/schemas/Error"})}
+	birdID := openAPIParameter{Name: "id", In: "path", Required: true, Schema: openAPISchema{Type: "integer"}}
+	birdBody := &openAPIRequestBody{Required: true, Content: jsonContent(bird)}
+
+	return openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Birds API", Version: openAPIVersion},
+		Paths: map[string]map[string]openAPIOperation{
+			"/bird": {
+				"get": {
+					Summary: "List every bird",
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The birds", Content: jsonContent(openAPISchema{Type: "array", Items: &bird})},
+					},
+				},
+				"post": {
+					Summary:     "Create a bird",
+					RequestBody: birdBody,
+					Responses: map[string]openAPIResponse{
+						"201": {Description: "The created bird", Content: jsonContent(bird)},
+						"400": birdError,
+						"409": birdError,
+						"413": birdError,
+						"422": birdError,
+					},
+				},
+			},
+			"/bird/{id}": {
+				"get": {
+					Summary:    "Get a bird",
+					Parameters: []openAPIParameter{birdID},
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The bird", Content: jsonContent(bird)},
+						"400": {Description: "The ID is not a number"},
+						"404": {Description: "There is no bird with the ID"},
+					},
+				},
+				"put": {
+					Summary:     "Replace the species and description of a bird",
+					Parameters:  []openAPIParameter{birdID, {Name: "If-Match", In: "header", Schema: openAPISchema{Type: "string"}}},
+					RequestBody: birdBody,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The updated bird", Content: jsonContent(bird)},
+						"400": {Description: "The ID is not a number, or the body is malformed"},
+						"404": {Description: "There is no bird with the ID"},
+						"409": {Description: "The bird was changed since the version of If-Match"},
+						"422": {Description: "The bird is invalid"},
+					},
+				},
+				"patch": {
+					Summary:     "Change only the given species or description of a bird",
+					Parameters:  []openAPIParameter{birdID},
+					RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(openAPISchema{Type: "object", Properties: map[string]openAPISchema{"species": {Type: "string"}, "description": {Type: "string"}}})},
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The updated bird", Content: jsonContent(bird)},
+						"400": {Description: "The ID is not a number, or the body is malformed or changes nothing"},
+						"404": {Description: "There is no bird with the ID"},
+						"409": birdError,
+						"422": {Description: "The changes are invalid"},
+					},
+				},
+				"delete": {
+					Summary:    "Delete a bird",
+					Parameters: []openAPIParameter{birdID},
+					Responses: map[string]openAPIResponse{
+						"204": {Description: "The bird was deleted"},
+						"400": {Description: "The ID is not a number"},
+						"404": {Description: "There is no bird with the ID"},
+					},
+				},
+			},
+			"/healthz": {
+				"get": {
+					Summary: "Check that the store can be reached",
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The service is up"},
+						"503": {Description: "The store can't be reached"},
+					},
+				},
+			},
+		},
+		Components: openAPIComponents{
+			Schemas: map[string]openAPISchema{
+				"Bird": {
+					Type:     "object",
+					Required: []string{"species"},
+					Properties: map[string]openAPISchema{
+						"id":          {Type: "integer", ReadOnly: true},
+						"species":     {Type: "string", MaxLength: maxSpeciesLength},
+						"description": {Type: "string", MaxLength: config.MaxDescriptionLength},
+						"created_at":  {Type: "string", Format: "date-time", ReadOnly: true},
+						"updated_at":  {Type: "string", Format: "date-time", ReadOnly: true},
+						"version":     {Type: "integer", ReadOnly: true},
+					},
+				},
+				"Error": {
+					Type:       "object",
+					Properties: map[string]openAPISchema{"error": {Type: "string"}},
+				},
+			},
+		},
+	}
+}
+
+// openAPIHandler serves the OpenAPI document of the API, for integrators
+// that generate their clients from it
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, openAPISpec())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(newServer(nil)).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&doc); err != nil {
+		t.Fatalf("the document is not valid JSON: %v", err)
+	}
+	if doc.OpenAPI == "" {
+		t.Errorf("the document should give its OpenAPI version")
+	}
+
+	expected := map[string][]string{
+		"/bird":      {"get", "post"},
+		"/bird/{id}": {"get", "put", "delete"},
+		"/healthz":   {"get"},
+	}
+	for path, methods := range expected {
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("the document doesn't describe %s %s", method, path)
+			}
+		}
+	}
+	if _, ok := doc.Components.Schemas["Bird"]; !ok {
+		t.Errorf("the document doesn't describe the Bird schema")
+	}
+}
+
+// TestOpenAPIRoutesExist makes sure that the document only describes routes
+// that the router actually serves
+func TestOpenAPIRoutesExist(t *testing.T) {
+	router := newRouter(newServer(nil))
+	for path, operations := range openAPISpec().Paths {
+		for method := range operations {
+			req := httptest.NewRequest(strings.ToUpper(method), strings.ReplaceAll(path, "{id}", "1"), nil)
+			var match mux.RouteMatch
+			if !router.Match(req, &match) || match.MatchErr != nil {
+				t.Errorf("%s %s is described, but not routed", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// optionsMiddleware answers `OPTIONS` requests for any path of the router with
+// 204 No Content, and an `Allow` header listing the methods the path can be
+// called with, which API discovery tools rely on. Paths that don't exist are
+// left to the router, which responds with a 404
+func optionsMiddleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		methods := allowedMethods(router, r)
+		if len(methods) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowedMethods finds the methods that the routes matching the path of `r`
+// accept, in alphabetical order, along with `OPTIONS` itself
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	allowed := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// The route accepts any method, which doesn't tell us anything
+			return nil
+		}
+		for _, method := range methods {
+			// Routes match on the method too, so we ask each route whether
+			// it would have taken the request with one of its methods
+			req := *r
+			req.Method = method
+			if route.Match(&req, &mux.RouteMatch{}) {
+				allowed[method] = true
+			}
+		}
+		return nil
+	})
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	allowed[http.MethodOptions] = true
+	methods := []string{}
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
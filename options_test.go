@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptionsMiddleware(t *testing.T) {
+	r := newRouter(newServer(nil))
+	hf := optionsMiddleware(r, r)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+		expectedAllow  string
+	}{
+		{"/bird", http.StatusNoContent, "DELETE, GET, HEAD, OPTIONS, POST"},
+		{"/bird/1/qr", http.StatusNoContent, "GET, OPTIONS"},
+		{"/admin/drain", http.StatusNoContent, "OPTIONS, POST"},
+		{"/nothing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("OPTIONS", tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				tt.path, status, tt.expectedStatus)
+		}
+		if allow := recorder.Header().Get("Allow"); allow != tt.expectedAllow {
+			t.Errorf("%s: wrong Allow header: got %q want %q", tt.path, allow, tt.expectedAllow)
+		}
+	}
+}
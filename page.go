@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Page is one page of a paginated list, along with what a client needs to know
+// to fetch the other pages. It is generic, so that every paginated resource
+// is served in the same envelope
+type Page[T any] struct {
+	Items  []*T `json:"items"`
+	Total  int  `json:"total"`
+	Limit  int  `json:"limit"`
+	Offset int  `json:"offset"`
+	// HasNext is true when there are more items after this page
+	HasNext bool `json:"has_next"`
+	// Links are the URLs of this page and of the ones around it, for
+	// hypermedia clients to follow
+	Links *PageLinks `json:"_links,omitempty"`
+}
+
+// PageLinks are the URLs of a page, and of the pages before and after it. The
+// previous and next pages are left out at the start and at the end of the list
+type PageLinks struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// newPage wraps the `items` found at `offset`, out of `total` items in the
+// whole list
+func newPage[T any](items []*T, total, limit, offset int) *Page[T] {
+	// An empty page should still have a JSON array of items, and not `null`
+	if items == nil {
+		items = []*T{}
+	}
+	return &Page[T]{
+		Items:   items,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasNext: offset+len(items) < total,
+	}
+}
+
+// setLinks fills in the links of the page, which was requested with `u`. The
+// other pages have the same URL, with a different offset
+func (p *Page[T]) setLinks(u *url.URL) {
+	link := func(offset int) string {
+		query := u.Query()
+		query.Set("limit", strconv.Itoa(p.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return u.Path + "?" + query.Encode()
+	}
+
+	p.Links = &PageLinks{Self: link(p.Offset)}
+	if p.HasNext {
+		p.Links.Next = link(p.Offset + p.Limit)
+	}
+	if p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		p.Links.Prev = link(prev)
+	}
+}
+
+// birdPages goes through all the birds, one page at a time, for batch jobs
+// running on the server. Pages are read with keyset pagination (the birds
+// after the last ID seen), so that birds created or removed along the way
+// don't shift the following pages, like they would with an offset
+type birdPages struct {
+	store  Store
+	size   int
+	lastID int
+	done   bool
+	// TotalPages is the number of pages, counted when the iteration started
+	TotalPages int
+}
+
+// newBirdPages prepares to go through the birds of `store`, `size` at a time
+func newBirdPages(ctx context.Context, store Store, size int) (*birdPages, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("the page size must be positive, got %d", size)
+	}
+	count, err := store.CountBirds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &birdPages{store: store, size: size, TotalPages: (count + size - 1) / size}, nil
+}
+
+// Next returns the next page of birds. It returns an empty page once every
+// bird has been returned
+func (p *birdPages) Next(ctx context.Context) ([]*Bird, error) {
+	if p.done {
+		return nil, nil
+	}
+	birds, err := p.store.BirdsAfter(ctx, p.lastID, p.size)
+	if err != nil {
+		return nil, err
+	}
+	if len(birds) < p.size {
+		p.done = true
+	}
+	if len(birds) > 0 {
+		p.lastID = birds[len(birds)-1].ID
+	}
+	return birds, nil
+}
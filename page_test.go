@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestNewPageHasNext(t *testing.T) {
+	items := []*Bird{{ID: 1}, {ID: 2}}
+
+	tests := []struct {
+		name            string
+		total, offset   int
+		expectedHasNext bool
+	}{
+		{"first page", 5, 0, true},
+		{"middle page", 5, 2, true},
+		{"last page", 4, 2, false},
+		{"only page", 2, 0, false},
+	}
+
+	for _, tt := range tests {
+		page := newPage(items, tt.total, 2, tt.offset)
+		if page.HasNext != tt.expectedHasNext {
+			t.Errorf("%s: HasNext should be %v, got %v", tt.name, tt.expectedHasNext, page.HasNext)
+		}
+	}
+
+	// A page past the end has no items, and nothing after it
+	page := newPage[Bird](nil, 4, 2, 10)
+	if page.HasNext || page.Items == nil || len(page.Items) != 0 {
+		t.Errorf("unexpected page past the end: %+v", page)
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	u, err := url.Parse("/bird?limit=2&offset=2&as=list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A middle page links to both of its neighbours, keeping the other query
+	// parameters
+	page := newPage([]*Bird{{ID: 3}, {ID: 4}}, 5, 2, 2)
+	page.setLinks(u)
+	expected := PageLinks{
+		Self: "/bird?as=list&limit=2&offset=2",
+		Next: "/bird?as=list&limit=2&offset=4",
+		Prev: "/bird?as=list&limit=2&offset=0",
+	}
+	if *page.Links != expected {
+		t.Errorf("wrong links for a middle page: got %+v want %+v", *page.Links, expected)
+	}
+
+	// The last page has nothing after it
+	u, err = url.Parse("/bird?limit=2&offset=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = newPage([]*Bird{{ID: 5}}, 5, 2, 4)
+	page.setLinks(u)
+	expected = PageLinks{
+		Self: "/bird?limit=2&offset=4",
+		Prev: "/bird?limit=2&offset=2",
+	}
+	if *page.Links != expected {
+		t.Errorf("wrong links for the last page: got %+v want %+v", *page.Links, expected)
+	}
+}
+
+func TestBirdPages(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	birds := []*Bird{}
+	for i := 0; i < 45; i++ {
+		birds = append(birds, &Bird{Species: "bird " + strconv.Itoa(i)})
+	}
+	if err := s.CreateBirds(ctx, birds); err != nil {
+		t.Fatal(err)
+	}
+	// A gap in the IDs shouldn't make the pages skip or repeat birds
+	if err := s.DeleteBird(ctx, 12); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := newBirdPages(ctx, s, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages.TotalPages != 5 {
+		t.Errorf("expected 5 pages, got %d", pages.TotalPages)
+	}
+
+	seen := map[int]bool{}
+	count := 0
+	for {
+		page, err := pages.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		count++
+		for _, bird := range page {
+			if seen[bird.ID] {
+				t.Errorf("bird %d was returned twice", bird.ID)
+			}
+			seen[bird.ID] = true
+		}
+	}
+	if count != pages.TotalPages {
+		t.Errorf("expected %d pages, got %d", pages.TotalPages, count)
+	}
+	if len(seen) != 44 {
+		t.Errorf("expected every one of the 44 birds, got %d", len(seen))
+	}
+
+	if _, err := newBirdPages(ctx, s, 0); err == nil {
+		t.Errorf("expected an error for a page size of 0")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+func TestGetBirdQRHandler(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	bird := &Bird{ID: 7, Species: "sparrow", Description: "A small harmless bird"}
+	mockStore.On("GetBirdByID", 7).Return(bird, nil).Once()
+
+	req, err := http.NewRequest("GET", "/bird/7/qr", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The handler reads the ID from the path variables that the router sets
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	recorder := httptest.NewRecorder()
+	hf := http.HandlerFunc(srv.getBirdQRHandler)
+	hf.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Wrong content type, expected image/png, got %s", contentType)
+	}
+
+	// Decode the QR code in the image, which should hold the bird as JSON
+	img, err := png.Decode(bytes.NewReader(recorder.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := qrcode.NewQRCodeReader().Decode(bmp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := json.Marshal(bird)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetText() != string(expected) {
+		t.Errorf("QR code holds unexpected content: got %s want %s", result.GetText(), expected)
+	}
+}
+
+func TestGetBirdQRHandlerErrors(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirdByID", 404).Return(nil, ErrBirdNotFound).Once()
+
+	tests := []struct {
+		id             string
+		expectedStatus int
+	}{
+		{"404", http.StatusNotFound},
+		{"sparrow", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/bird/"+tt.id+"/qr", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+		recorder := httptest.NewRecorder()
+		hf := http.HandlerFunc(srv.getBirdQRHandler)
+		hf.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("id %s: handler returned wrong status code: got %v want %v",
+				tt.id, status, tt.expectedStatus)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// QueryOptions is a filter on the birds, for the store methods that work on
+// all the birds matching it. Fields left empty don't filter anything
+type QueryOptions struct {
+	// Species matches the birds with exactly this species
+	Species string
+}
+
+// errEmptyFilter is returned by the store methods that refuse to work on every
+// bird at once, when they are given `QueryOptions` that don't filter anything
+var errEmptyFilter = errors.New("the filter must select some birds")
+
+// queryOptionsFromURL reads the filter from the query parameters of a request,
+// such as `?species=eagle`
+func queryOptionsFromURL(query url.Values) QueryOptions {
+	return QueryOptions{Species: query.Get("species")}
+}
+
+// isEmpty tells if the options match every bird
+func (o QueryOptions) isEmpty() bool {
+	return o.Species == ""
+}
+
+// matches tells if `bird` is selected by the options
+func (o QueryOptions) matches(bird *Bird) bool {
+	return o.Species == "" || bird.Species == o.Species
+}
+
+// where builds the SQL condition for the options, as in
+// ` WHERE species = $1`, along with its arguments. It is empty when the options
+// don't filter anything
+func (o QueryOptions) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if o.Species != "" {
+		args = append(args, o.Species)
+		conditions = append(conditions, "species = $"+strconv.Itoa(len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleLimiterTTL is how long the limiter of a client is kept after its last
+// request. A client coming back after that starts again with a full burst
+const idleLimiterTTL = 3 * time.Minute
+
+// ipRateLimiters holds a token bucket for each client IP
+type ipRateLimiters struct {
+	mu        sync.Mutex
+	rps       rate.Limit
+	burst     int
+	limiters  map[string]*ipRateLimiter
+	lastSweep time.Time
+}
+
+type ipRateLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// get returns the limiter of `ip`, creating it on its first request. The
+// limiters of the clients that went quiet are dropped along the way, so that
+// the map doesn't grow with every address that ever called us
+func (l *ipRateLimiters) get(ip string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > idleLimiterTTL {
+		for key, entry := range l.limiters {
+			if now.Sub(entry.lastSeen) > idleLimiterTTL {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &ipRateLimiter{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter
+}
+
+// rateLimitMiddleware lets each client IP make `rps` requests per second, with
+// bursts of up to `burst` requests. Requests over the limit get 429 Too Many
+// Requests, and a `Retry-After` header with the number of seconds to wait.
+// Clients behind a trusted proxy are told apart by `ClientIP`
+func rateLimitMiddleware(rps float64, burst int, next http.Handler) http.Handler {
+	limiters := &ipRateLimiters{rps: rate.Limit(rps), burst: burst, limiters: map[string]*ipRateLimiter{}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		reservation := limiters.get(ClientIP(r), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			// The request isn't served, so it shouldn't use up a token
+			reservation.CancelAt(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "too many requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	h := rateLimitMiddleware(1, 3, http.HandlerFunc(handler))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/hello", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// The burst goes through, and the next request is over the limit
+	for i := 0; i < 3; i++ {
+		if status := request("192.0.2.1:1234").Code; status != http.StatusOK {
+			t.Fatalf("request %d: handler returned wrong status code: got %v want %v", i, status, http.StatusOK)
+		}
+	}
+	recorder := request("192.0.2.1:1234")
+	if status := recorder.Code; status != http.StatusTooManyRequests {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusTooManyRequests)
+	}
+	if retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After")); err != nil || retryAfter < 1 {
+		t.Errorf("expected a Retry-After in seconds, got %q", recorder.Header().Get("Retry-After"))
+	}
+
+	// Another client has a limit of its own
+	if status := request("192.0.2.2:1234").Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code for another IP: got %v want %v", status, http.StatusOK)
+	}
+}
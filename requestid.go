@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// requestIDMiddleware makes sure every request carries an ID, so that it can
+// be followed across the services it goes through. The ID is read from the
+// `header` request header, which is set by the proxies in front of us, or
+// generated when the request doesn't have one, or has one that isn't valid
+// (see `validRequestID`). It is echoed back in the same header of the
+// response, and kept in the context of the request for the handlers and logs
+// (see `requestIDFromContext`). Infrastructures disagree on the name of the
+// header (`X-Request-ID`, `X-Correlation-ID`, `Request-Id`...), so it is
+// configurable
+func requestIDMiddleware(header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(header, id)
+		}
+		w.Header().Set(header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// maxRequestIDLength is the longest request ID accepted from a client
+const maxRequestIDLength = 128
+
+// validRequestID tells whether `id`, given by the client, can be used as the
+// request ID. It is echoed in the responses and written in the `key=value`
+// log lines, so it is limited to letters, digits, `.`, `_` and `-`, which
+// can't forge headers or log fields
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDKey is the key of the request ID in the context of a request
+type requestIDKey struct{}
+
+// requestIDFromContext returns the ID given to the request by
+// `requestIDMiddleware`, or "" when it has none
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID generates a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	// Reading from crypto/rand doesn't fail on the platforms we run on
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		header     string
+		requestID  string
+		expectedID string
+	}{
+		{"X-Request-ID", "abc", "abc"},
+		{"X-Correlation-ID", "def", "def"},
+		{"X-Correlation-ID", "", ""},
+		{"X-Request-ID", "trace_1.2-3", "trace_1.2-3"},
+		// IDs that could forge log fields, or are too long, are replaced
+		{"X-Request-ID", "x status=200", ""},
+		{"X-Request-ID", "abc\tdef", ""},
+		{"X-Request-ID", strings.Repeat("a", 129), ""},
+	}
+
+	for _, tt := range tests {
+		hf := requestIDMiddleware(tt.header, http.HandlerFunc(handler))
+		req, err := http.NewRequest("GET", "/hello", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.requestID != "" {
+			req.Header.Set(tt.header, tt.requestID)
+		}
+		recorder := httptest.NewRecorder()
+		hf.ServeHTTP(recorder, req)
+
+		id := recorder.Header().Get(tt.header)
+		switch {
+		case tt.expectedID != "" && id != tt.expectedID:
+			t.Errorf("%s: the request ID should be echoed: got %q want %q", tt.header, id, tt.expectedID)
+		case tt.expectedID == "" && !uuid.MatchString(id):
+			t.Errorf("%s: a UUID should be generated, got %q", tt.header, id)
+		}
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	// The ID reaches the handlers, and the logs, the same way as in `main`
+	var seen string
+	h := requestIDMiddleware("X-Request-ID", loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	})))
+
+	for _, given := range []string{"abc", ""} {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/hello", nil)
+		if given != "" {
+			req.Header.Set("X-Request-ID", given)
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+
+		id := recorder.Header().Get("X-Request-ID")
+		if given != "" && id != given {
+			t.Errorf("the supplied ID should be echoed: got %q want %q", id, given)
+		}
+		if id == "" || seen != id {
+			t.Errorf("the handler should see the ID of the response %q, got %q", id, seen)
+		}
+		if !strings.HasSuffix(strings.TrimSpace(logs.String()), " request_id="+id) {
+			t.Errorf("expected the ID in the log line, got %q", logs.String())
+		}
+	}
+
+	// Requests that went around the middleware have no ID
+	if id := requestIDFromContext(context.Background()); id != "" {
+		t.Errorf("expected no ID, got %q", id)
+	}
+}
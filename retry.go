@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+const (
+	// defaultRetries is how many more times `dbStore` tries a statement that
+	// failed on a dead connection, when `retries` isn't set
+	defaultRetries = 3
+	// defaultRetryBackoff is how long `dbStore` waits before its first retry,
+	// when `retryBackoff` isn't set. The wait doubles with every retry
+	defaultRetryBackoff = 100 * time.Millisecond
+)
+
+// withRetry runs `fn`, and runs it again while it fails with
+// `driver.ErrBadConn`, which is what is left after `database/sql` itself
+// gave up on its pool, such as when the database restarted between requests.
+// Drivers only report a bad connection when the statement wasn't sent, so it
+// is safe to retry writes too. The waits between tries are cut short when
+// `ctx` is done
+func (store *dbStore) withRetry(ctx context.Context, fn func() error) error {
+	retries, backoff := store.retries, store.retryBackoff
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	err := fn()
+	for i := 0; i < retries && errors.Is(err, driver.ErrBadConn); i++ {
+		timer := time.NewTimer(backoff << i)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		err = fn()
+	}
+	return err
+}
+
+// queryContext is `db.QueryContext`, retried on a dead connection
+func (store *dbStore) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := store.withRetry(ctx, func() (err error) {
+		rows, err = store.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// queryRowContext is `db.QueryRowContext`, retried on a dead connection. The
+// error of the query is kept in the row, like with `database/sql`
+func (store *dbStore) queryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+	store.withRetry(ctx, func() error {
+		row = store.db.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// execContext is `db.ExecContext`, retried on a dead connection
+func (store *dbStore) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := store.withRetry(ctx, func() (err error) {
+		result, err = store.db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// beginTx is `db.BeginTx`, retried on a dead connection. Once a transaction
+// has started, its statements aren't retried, since the connection it is
+// bound to can't be swapped for another
+func (store *dbStore) beginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := store.withRetry(ctx, func() (err error) {
+		tx, err = store.db.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyConnector is a database whose queries fail with a dead connection a
+// number of times, before they return a count of 42
+type flakyConnector struct {
+	mu       sync.Mutex
+	failures int
+	queries  int
+}
+
+func (c *flakyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &flakyConn{c}, nil
+}
+
+func (c *flakyConnector) Driver() driver.Driver { return nil }
+
+type flakyConn struct{ connector *flakyConnector }
+
+func (c *flakyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.mu.Lock()
+	defer c.connector.mu.Unlock()
+	c.connector.queries++
+	if c.connector.failures > 0 {
+		c.connector.failures--
+		return nil, driver.ErrBadConn
+	}
+	return &countRows{count: 42}, nil
+}
+
+func (c *flakyConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *flakyConn) Close() error              { return nil }
+func (c *flakyConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+// countRows is a single row, with a single column
+type countRows struct {
+	count int64
+	done  bool
+}
+
+func (r *countRows) Columns() []string { return []string{"count"} }
+func (r *countRows) Close() error      { return nil }
+func (r *countRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.count
+	return nil
+}
+
+// sqlBadConnTries is how many times `database/sql` tries a query on its own
+// when the connection is dead, before it hands `driver.ErrBadConn` to us
+const sqlBadConnTries = 3
+
+func TestDBStoreRetriesBadConn(t *testing.T) {
+	// The first two tries of the store fail, and the third one succeeds
+	connector := &flakyConnector{failures: 2 * sqlBadConnTries}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	s := &dbStore{db: db, retries: 3, retryBackoff: time.Millisecond}
+
+	count, err := s.CountBirds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 42 {
+		t.Errorf("expected the count of the last try, got %d", count)
+	}
+	if connector.queries != 2*sqlBadConnTries+1 {
+		t.Errorf("expected the query to be tried until it succeeded, got %d tries", connector.queries)
+	}
+}
+
+func TestDBStoreRetriesGiveUp(t *testing.T) {
+	connector := &flakyConnector{failures: 100}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	s := &dbStore{db: db, retries: 2, retryBackoff: time.Millisecond}
+
+	if _, err := s.CountBirds(context.Background()); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected the bad connection error once the retries ran out, got %v", err)
+	}
+	if connector.queries != 3*sqlBadConnTries {
+		t.Errorf("expected the first try and 2 retries, got %d queries", connector.queries)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	s := &dbStore{retries: 3, retryBackoff: time.Millisecond}
+
+	// Other errors aren't retried
+	tries := 0
+	failure := errors.New("syntax error")
+	err := s.withRetry(context.Background(), func() error {
+		tries++
+		return failure
+	})
+	if err != failure || tries != 1 {
+		t.Errorf("expected a single try, got %d tries and %v", tries, err)
+	}
+
+	// The retries stop when the context is done
+	s.retryBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = s.withRetry(ctx, func() error { return driver.ErrBadConn })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
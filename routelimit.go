@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// routeLimiter caps the number of requests that each route serves at the same
+// time, so that a few expensive endpoints (like exports) can't take up all of
+// the server. Routes are identified by their path template, such as
+// "/bird/{id}/qr", and routes without a cap are not limited
+type routeLimiter struct {
+	// slots holds a semaphore for each capped route: a request takes a slot
+	// by sending to the channel, and gives it back by receiving from it. The
+	// map is only written to by `newRouteLimiter`, so it is safe to read from
+	// any goroutine
+	slots map[string]chan struct{}
+}
+
+// newRouteLimiter caps each route template of `limits` to that many requests
+// at once
+func newRouteLimiter(limits map[string]int) *routeLimiter {
+	l := &routeLimiter{slots: map[string]chan struct{}{}}
+	for template, limit := range limits {
+		l.slots[template] = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// middleware is a `mux` middleware, which runs after the route is matched.
+// Requests over the cap of their route are turned away with 503 Service
+// Unavailable instead of being queued
+func (l *routeLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var slots chan struct{}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				slots = l.slots[template]
+			}
+		}
+		if slots == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeJSONError(w, http.StatusServiceUnavailable, "too many requests in progress for this endpoint")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRouteLimiter(t *testing.T) {
+	// The slow route holds on to its requests until it is released
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := mux.NewRouter()
+	r.HandleFunc("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+	r.HandleFunc("/hello", handler)
+	r.Use(newRouteLimiter(map[string]int{"/slow/{id}": 1}).middleware)
+	mockServer := httptest.NewServer(r)
+	defer mockServer.Close()
+
+	// Take up the only slot of the slow route
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := http.Get(mockServer.URL + "/slow/1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+	}()
+	<-started
+
+	// Another request for the same route, even with a different ID, should
+	// be turned away...
+	resp, err := http.Get(mockServer.URL + "/slow/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Status should be 503, got %d", resp.StatusCode)
+	}
+
+	// ...while other routes are unaffected
+	resp, err = http.Get(mockServer.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status should be ok, got %d", resp.StatusCode)
+	}
+
+	// Once the slow request is done, its slot is free again
+	close(release)
+	<-done
+	go func() { <-started }()
+	resp, err = http.Get(mockServer.URL + "/slow/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status should be ok, got %d", resp.StatusCode)
+	}
+}
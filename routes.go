@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gorilla/mux"
+)
+
+// validateRoutes checks that no method and path template is registered twice
+// on `router`. mux silently serves such requests with the first route, so the
+// second handler would never run
+func validateRoutes(router *mux.Router) error {
+	seen := map[string]bool{}
+	return router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			// Routes without a path, such as subrouters matching on the host,
+			// can't clash with the others
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"*"}
+		}
+		for _, method := range methods {
+			key := method + " " + template
+			if seen[key] {
+				return fmt.Errorf("the route %s is registered more than once", key)
+			}
+			seen[key] = true
+		}
+		return nil
+	})
+}
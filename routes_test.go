@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	if err := validateRoutes(newRouter(newServer(nil))); err != nil {
+		t.Errorf("the routes of the application should be valid: %v", err)
+	}
+
+	r := newRouter(newServer(nil))
+	r.HandleFunc("/bird/{id}", handler).Methods("GET")
+	err := validateRoutes(r)
+	if err == nil {
+		t.Fatal("expected an error for a route registered twice")
+	}
+	if expected := "the route GET /bird/{id} is registered more than once"; err.Error() != expected {
+		t.Errorf("wrong error: got %q want %q", err.Error(), expected)
+	}
+
+	// The same path with another method is fine
+	r = newRouter(newServer(nil))
+	r.HandleFunc("/bird/{id}", handler).Methods(http.MethodPost)
+	if err := validateRoutes(r); err != nil {
+		t.Errorf("a new method on an existing path should be valid: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// scheduler runs recurring maintenance tasks (such as refreshing caches or
+// purging old data) in the background, each at its own interval
+type scheduler struct {
+	tasks []scheduledTask
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	run      func()
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{stop: make(chan struct{})}
+}
+
+// Every registers a task to run once per `interval`. Tasks must be registered
+// before the scheduler is started
+func (s *scheduler) Every(interval time.Duration, name string, run func()) {
+	s.tasks = append(s.tasks, scheduledTask{name: name, interval: interval, run: run})
+}
+
+// Start runs each task in its own goroutine, until Stop is called
+func (s *scheduler) Start() {
+	for _, task := range s.tasks {
+		s.wg.Add(1)
+		go func(task scheduledTask) {
+			defer s.wg.Done()
+			ticker := time.NewTicker(task.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.runTask(task)
+				case <-s.stop:
+					return
+				}
+			}
+		}(task)
+	}
+}
+
+// runTask runs a single execution of a task. A task that panics is logged,
+// and tried again at its next interval, rather than taking the server down
+func (s *scheduler) runTask(task scheduledTask) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Println(fmt.Errorf("Error: scheduled task %s panicked: %v", task.name, err))
+		}
+	}()
+	task.run()
+}
+
+// Stop tells the tasks to stop, and waits for any that are running to finish
+func (s *scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
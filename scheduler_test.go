@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler()
+
+	var runs atomic.Int32
+	ran := make(chan struct{}, 1)
+	s.Every(10*time.Millisecond, "test", func() {
+		runs.Add(1)
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	})
+	// A task that panics shouldn't stop the others
+	s.Every(10*time.Millisecond, "panics", func() { panic("oops") })
+
+	s.Start()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("task did not run")
+	}
+	s.Stop()
+
+	// No more runs should happen once the scheduler has stopped
+	stopped := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Errorf("task ran after the scheduler was stopped")
+	}
+}
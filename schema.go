@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// schemaVersion is the version of the schema that this build of the
+// application works with. It is bumped along with any change to `schema`, and
+// recorded in the `schema_version` table by the migration
+const schemaVersion = 4
+
+// schema describes the `birds` table that `dbStore` reads from and writes to.
+// Every statement is idempotent, so it can be run against a fresh database as
+// well as one created by an earlier version of the application. Species are
+// unique, so a database that already has duplicates has to be cleaned up
+// before it can be migrated.
+const schema = `
+CREATE TABLE IF NOT EXISTS birds (
+	species     TEXT,
+	description TEXT
+);
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS id SERIAL PRIMARY KEY;
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS views INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE birds ADD COLUMN IF NOT EXISTS description_tsv TSVECTOR
+	GENERATED ALWAYS AS (to_tsvector('english', coalesce(description, ''))) STORED;
+CREATE INDEX IF NOT EXISTS birds_description_tsv_idx ON birds USING GIN (description_tsv);
+CREATE UNIQUE INDEX IF NOT EXISTS birds_species_key ON birds (species);
+CREATE TABLE IF NOT EXISTS schema_version (
+	id      BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+	version INTEGER NOT NULL
+);
+`
+
+// schemaSQL returns the statements that bring the database up to date with the
+// current configuration: the `schema`, followed by the constraints that depend
+// on settings, which are replaced when they don't match the settings anymore.
+// Every instance running against the same database must share these
+// settings, or each would put back its own constraint when it starts
+func schemaSQL() string {
+	// The constraint is only replaced when its definition changed, since
+	// altering the table locks it out of every query until the end of the
+	// migration. NOT VALID skips checking the existing rows, so that lowering
+	// the limit doesn't prevent the application from starting
+	//
+	// The version is never lowered, so that an older build can't hide that
+	// the database was migrated by a newer one
+	return schema + fmt.Sprintf(`
+DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM pg_constraint
+		WHERE conrelid = 'birds'::regclass AND conname = 'birds_description_length'
+			AND pg_get_constraintdef(oid) LIKE '%%(char_length(description) <= %[1]d)%%'
+	) THEN
+		ALTER TABLE birds DROP CONSTRAINT IF EXISTS birds_description_length;
+		ALTER TABLE birds ADD CONSTRAINT birds_description_length CHECK (char_length(description) <= %[1]d) NOT VALID;
+	END IF;
+END
+$$;
+INSERT INTO schema_version (version) VALUES (%[2]d)
+	ON CONFLICT (id) DO UPDATE SET version = GREATEST(schema_version.version, EXCLUDED.version);
+`, config.MaxDescriptionLength, schemaVersion)
+}
+
+// checkSchemaVersion makes sure that the schema of the store is the one this
+// build expects, so that the application doesn't run against a database it
+// doesn't understand
+func checkSchemaVersion(ctx context.Context, s Store) error {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("reading the schema version: %w", err)
+	}
+	if version != schemaVersion {
+		return fmt.Errorf("the database schema is at version %d, but this build expects version %d", version, schemaVersion)
+	}
+	return nil
+}
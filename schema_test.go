@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckSchemaVersion(t *testing.T) {
+	mockStore := InitMockStore()
+	mockStore.On("SchemaVersion").Return(schemaVersion, nil).Once()
+	mockStore.On("SchemaVersion").Return(schemaVersion+1, nil).Once()
+	mockStore.On("SchemaVersion").Return(0, nil).Once()
+
+	if err := checkSchemaVersion(context.Background(), mockStore); err != nil {
+		t.Errorf("expected no error for the expected version, got %v", err)
+	}
+	// A database migrated by a newer build, or never migrated at all
+	for i := 0; i < 2; i++ {
+		if err := checkSchemaVersion(context.Background(), mockStore); err == nil {
+			t.Errorf("expected an error for a mismatched version")
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
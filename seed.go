@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+)
+
+// seedFS holds the sample birds of `-seed`, built into the binary so that
+// demos don't depend on the files around it
+//
+//go:embed seed/birds.json
+var seedFS embed.FS
+
+// seedBirds creates the sample birds in `store`, for demos and local
+// development, and returns how many it created. A store that already has
+// birds is left alone, so that restarting with `-seed` doesn't add them again
+func seedBirds(ctx context.Context, store Store) (int, error) {
+	count, err := store.CountBirds(ctx)
+	if err != nil || count > 0 {
+		return 0, err
+	}
+
+	data, err := seedFS.ReadFile("seed/birds.json")
+	if err != nil {
+		return 0, err
+	}
+	var birds []*Bird
+	if err := json.Unmarshal(data, &birds); err != nil {
+		return 0, err
+	}
+	if err := store.CreateBirds(ctx, birds); err != nil {
+		return 0, err
+	}
+	return len(birds), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSeedBirds(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+
+	// An empty store gets the sample birds...
+	seeded, err := seedBirds(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seeded == 0 {
+		t.Fatal("expected the sample birds to be created")
+	}
+	birds, err := s.GetBirds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(birds) != seeded {
+		t.Errorf("expected %d birds, got %d", seeded, len(birds))
+	}
+	for _, bird := range birds {
+		if err := bird.validate(); err != nil {
+			t.Errorf("the sample bird %q is invalid: %v", bird.Species, err)
+		}
+	}
+
+	// ...only once
+	seeded, err = seedBirds(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.CountBirds(ctx); seeded != 0 || count != len(birds) {
+		t.Errorf("seeding again should be a no-op, got %d seeded and %d birds", seeded, count)
+	}
+}
+
+func TestSeedBirdsNotEmpty(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	if err := s.CreateBird(ctx, &Bird{Species: "dodo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if seeded, err := seedBirds(ctx, s); err != nil || seeded != 0 {
+		t.Errorf("a store with birds should be left alone, got %d seeded (%v)", seeded, err)
+	}
+	if count, _ := s.CountBirds(ctx); count != 1 {
+		t.Errorf("expected only the existing bird, got %d birds", count)
+	}
+}
+
+func TestInitStoreSeedsMemStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := initStore(ctx, "", 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*memStore); !ok {
+		t.Fatalf("expected a memStore without a database, got %T", store)
+	}
+	if count, _ := store.CountBirds(ctx); count == 0 {
+		t.Errorf("the store should have been seeded")
+	}
+}
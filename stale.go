@@ -0,0 +1,26 @@
+package main
+
+import "sync"
+
+// staleBirds keeps the last list of birds read from the store, so that it can
+// still be served when the database is down. It is shared by every request,
+// so the list is guarded by a mutex
+type staleBirds struct {
+	mu    sync.Mutex
+	birds []*Bird
+	ok    bool
+}
+
+// set replaces the list with one that was just read from the store
+func (c *staleBirds) set(birds []*Bird) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.birds, c.ok = birds, true
+}
+
+// get returns the last list, and whether there is one at all
+func (c *staleBirds) get() ([]*Bird, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.birds, c.ok
+}
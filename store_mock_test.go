@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// The mock store contains additonal methods for inspection, provided by the
+// testify `mock.Mock` type. Tests declare what each method should return with
+// `On(...).Return(...)` and can later assert how the store was called
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) CreateBird(ctx context.Context, bird *Bird) error {
+	/*
+		When this method is called, `m.Called` records the call, and also
+		returns the result that we pass to it (which you will see in the
+		handler tests)
+	*/
+	rets := m.Called(bird)
+	return rets.Error(0)
+}
+
+func (m *MockStore) CreateBirds(ctx context.Context, birds []*Bird) error {
+	rets := m.Called(birds)
+	return rets.Error(0)
+}
+
+func (m *MockStore) ImportBirds(ctx context.Context, birds []*Bird, strategy ConflictStrategy) ([]ImportOutcome, error) {
+	rets := m.Called(birds, strategy)
+	outcomes, _ := rets.Get(0).([]ImportOutcome)
+	return outcomes, rets.Error(1)
+}
+
+func (m *MockStore) GetBirds(ctx context.Context) ([]*Bird, error) {
+	rets := m.Called()
+	/*
+		Since `rets.Get()` is a generic method, that returns whatever we pass to it,
+		we need to typecast it to the type we expect, which in this case is []*Bird
+	*/
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+// EachBird calls `fn` with the birds given to `Return`
+func (m *MockStore) EachBird(ctx context.Context, fn func(*Bird) error) error {
+	rets := m.Called()
+	birds, _ := rets.Get(0).([]*Bird)
+	for _, bird := range birds {
+		if err := fn(bird); err != nil {
+			return err
+		}
+	}
+	return rets.Error(1)
+}
+
+func (m *MockStore) Ping(ctx context.Context) error {
+	rets := m.Called()
+	return rets.Error(0)
+}
+
+func (m *MockStore) SelfTest(ctx context.Context) error {
+	rets := m.Called()
+	return rets.Error(0)
+}
+
+func (m *MockStore) CountBirds(ctx context.Context) (int, error) {
+	rets := m.Called()
+	return rets.Int(0), rets.Error(1)
+}
+
+func (m *MockStore) BirdsAfter(ctx context.Context, afterID, limit int) ([]*Bird, error) {
+	rets := m.Called(afterID, limit)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) MaxBirdID(ctx context.Context) (int, error) {
+	rets := m.Called()
+	return rets.Int(0), rets.Error(1)
+}
+
+func (m *MockStore) DatasetChecksum(ctx context.Context) (string, error) {
+	rets := m.Called()
+	return rets.String(0), rets.Error(1)
+}
+
+func (m *MockStore) GetBirdsPage(ctx context.Context, limit, offset int) (*Page[Bird], error) {
+	rets := m.Called(limit, offset)
+	page, _ := rets.Get(0).(*Page[Bird])
+	return page, rets.Error(1)
+}
+
+func (m *MockStore) GetBirdByID(ctx context.Context, id int) (*Bird, error) {
+	rets := m.Called(id)
+	bird, _ := rets.Get(0).(*Bird)
+	return bird, rets.Error(1)
+}
+
+func (m *MockStore) RecentBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	rets := m.Called(limit)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) UpdateColumns(ctx context.Context, id int, fields map[string]any) error {
+	rets := m.Called(id, fields)
+	return rets.Error(0)
+}
+
+func (m *MockStore) GetBirdsPageWithFacets(ctx context.Context, opts QueryOptions, limit, offset int) (*FacetedPage, error) {
+	rets := m.Called(opts, limit, offset)
+	page, _ := rets.Get(0).(*FacetedPage)
+	return page, rets.Error(1)
+}
+
+func (m *MockStore) TopBirds(ctx context.Context, limit int) ([]*Bird, error) {
+	rets := m.Called(limit)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) RecentlyUpdated(ctx context.Context, limit int) ([]*Bird, error) {
+	rets := m.Called(limit)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) UpdateBird(ctx context.Context, id int, bird *Bird) error {
+	rets := m.Called(id, bird)
+	return rets.Error(0)
+}
+
+func (m *MockStore) PatchBird(ctx context.Context, id int, species, description *string) error {
+	rets := m.Called(id, species, description)
+	return rets.Error(0)
+}
+
+func (m *MockStore) SchemaVersion(ctx context.Context) (int, error) {
+	rets := m.Called()
+	return rets.Int(0), rets.Error(1)
+}
+
+func (m *MockStore) FindFirst(ctx context.Context, opts QueryOptions) (*Bird, error) {
+	rets := m.Called(opts)
+	bird, _ := rets.Get(0).(*Bird)
+	return bird, rets.Error(1)
+}
+
+func (m *MockStore) DeleteBirdsMatching(ctx context.Context, opts QueryOptions) (int, error) {
+	rets := m.Called(opts)
+	return rets.Int(0), rets.Error(1)
+}
+
+func (m *MockStore) IncrementViews(ctx context.Context, id int) error {
+	rets := m.Called(id)
+	return rets.Error(0)
+}
+
+func (m *MockStore) DeleteBird(ctx context.Context, id int) error {
+	rets := m.Called(id)
+	return rets.Error(0)
+}
+
+func (m *MockStore) DeleteAllBirds(ctx context.Context) error {
+	rets := m.Called()
+	return rets.Error(0)
+}
+
+func (m *MockStore) ReplaceDescription(ctx context.Context, placeholder, replacement string) (int, error) {
+	rets := m.Called(placeholder, replacement)
+	return rets.Int(0), rets.Error(1)
+}
+
+func (m *MockStore) FirstAndLastBird(ctx context.Context) (*Bird, *Bird, error) {
+	rets := m.Called()
+	first, _ := rets.Get(0).(*Bird)
+	last, _ := rets.Get(1).(*Bird)
+	return first, last, rets.Error(2)
+}
+
+func (m *MockStore) CountsByDay(ctx context.Context, from, to time.Time) (map[string]int, error) {
+	rets := m.Called(from, to)
+	counts, _ := rets.Get(0).(map[string]int)
+	return counts, rets.Error(1)
+}
+
+func (m *MockStore) SearchBirds(ctx context.Context, species, descKeyword string) ([]*Bird, error) {
+	rets := m.Called(species, descKeyword)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) FindBirdsBySpecies(ctx context.Context, name string) ([]*Bird, error) {
+	rets := m.Called(name)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) BirdsBySpeciesList(ctx context.Context, species []string) ([]*Bird, error) {
+	rets := m.Called(species)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) BirdsByInitial(ctx context.Context, letter string) ([]*Bird, error) {
+	rets := m.Called(letter)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) SpeciesInitials(ctx context.Context) ([]string, error) {
+	rets := m.Called()
+	initials, _ := rets.Get(0).([]string)
+	return initials, rets.Error(1)
+}
+
+func (m *MockStore) SpeciesCounts(ctx context.Context) (map[string]int, error) {
+	rets := m.Called()
+	counts, _ := rets.Get(0).(map[string]int)
+	return counts, rets.Error(1)
+}
+
+func (m *MockStore) BirdsByDescriptionLength(ctx context.Context, min, max int) ([]*Bird, error) {
+	rets := m.Called(min, max)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) BirdsMissingDescription(ctx context.Context) ([]*Bird, error) {
+	rets := m.Called()
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) BirdsModifiedSince(ctx context.Context, t time.Time) ([]*Bird, error) {
+	rets := m.Called(t)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) StaleBirds(ctx context.Context, before time.Time) ([]*Bird, error) {
+	rets := m.Called(before)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+func (m *MockStore) FullTextSearch(ctx context.Context, query string) ([]*Bird, error) {
+	rets := m.Called(query)
+	birds, _ := rets.Get(0).([]*Bird)
+	return birds, rets.Error(1)
+}
+
+// InitMockStore creates a new mock store, to give to the server under test
+// with `newServer`
+func InitMockStore() *MockStore {
+	return new(MockStore)
+}
@@ -0,0 +1,1485 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	// The "testify/suite" package is used to make the test suite
+	"github.com/stretchr/testify/suite"
+)
+
+// testConnString points at the database used by the store tests and
+// benchmarks. It is read from TEST_DATABASE_URL, and is empty when no test
+// database is available
+var testConnString = os.Getenv("TEST_DATABASE_URL")
+
+type StoreSuite struct {
+	suite.Suite
+	/*
+		The suite is defined as a struct, with the store and db as its
+		attributes. Any variables that are to be shared between tests in a
+		suite should be stored as attributes of the suite instance
+	*/
+	store *dbStore
+	db    *sql.DB
+}
+
+func (s *StoreSuite) SetupSuite() {
+	/*
+		The database connection is opened in the setup, and
+		stored as an instance variable,
+		as is the higher level `store`, that wraps the `db`
+	*/
+	db, err := sql.Open("postgres", testConnString)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.db = db
+	s.store = &dbStore{db: db}
+
+	// Make sure the `birds` table has all the columns the store expects
+	if _, err := db.Exec(schemaSQL()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *StoreSuite) SetupTest() {
+	/*
+		We delete all entries from the table before each test runs, to ensure a
+		consistent state before our tests run. In more complex applications, this
+		is sometimes achieved in the form of migrations
+	*/
+	_, err := s.db.Query("DELETE FROM birds")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *StoreSuite) TearDownSuite() {
+	// Close the connection after all tests in the suite finish
+	s.db.Close()
+}
+
+// This is the actual "test" as seen by Go, which runs the tests defined below
+func TestStoreSuite(t *testing.T) {
+	if testConnString == "" {
+		t.Skip("TEST_DATABASE_URL is not set, skipping the postgres store tests")
+	}
+	s := new(StoreSuite)
+	suite.Run(t, s)
+}
+
+func (s *StoreSuite) TestSelfTest() {
+	if err := s.store.SelfTest(context.Background()); err != nil {
+		s.T().Errorf("the self-test failed against a working database: %v", err)
+	}
+}
+
+func (s *StoreSuite) TestCreateBird() {
+	ctx := context.Background()
+	// Create a bird through the store `CreateBird` method
+	bird := &Bird{
+		Description: "test description",
+		Species:     "test species",
+	}
+	if err := s.store.CreateBird(ctx, bird); err != nil {
+		s.T().Fatal(err)
+	}
+	// The bird should have been given its ID
+	if bird.ID == 0 || bird.CreatedAt.IsZero() {
+		s.T().Errorf("the created bird wasn't filled in: %+v", bird)
+	}
+
+	// Query the database for the entry we just created
+	res, err := s.db.Query(`SELECT COUNT(*) FROM birds WHERE description='test description' AND SPECIES='test species'`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Get the count result
+	var count int
+	for res.Next() {
+		err := res.Scan(&count)
+		if err != nil {
+			s.T().Error(err)
+		}
+	}
+
+	// Assert that there must be one entry with the properties of the bird that we just inserted (since the database was empty before this)
+	if count != 1 {
+		s.T().Errorf("incorrect count, wanted 1, got %d", count)
+	}
+}
+
+func (s *StoreSuite) TestCreateBirdDuplicateSpecies() {
+	ctx := context.Background()
+	if err := s.store.CreateBird(ctx, &Bird{Species: "sparrow", Description: "first"}); err != nil {
+		s.T().Fatal(err)
+	}
+	err := s.store.CreateBird(ctx, &Bird{Species: "sparrow", Description: "second"})
+	if !isUniqueViolation(err) {
+		s.T().Errorf("expected a unique violation, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestCreateBirdsInChunks() {
+	ctx := context.Background()
+	// Use a tiny batch size, so that the birds need several INSERT statements
+	s.store.batchSize = 3
+	defer func() { s.store.batchSize = 0 }()
+
+	birds := []*Bird{}
+	for i := 0; i < 10; i++ {
+		birds = append(birds, &Bird{Species: fmt.Sprintf("species %d", i), Description: "batch"})
+	}
+	if err := s.store.CreateBirds(ctx, birds); err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Every bird should have been inserted, including the ones in the last,
+	// partial chunk
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM birds WHERE description='batch'`).Scan(&count); err != nil {
+		s.T().Fatal(err)
+	}
+	if count != len(birds) {
+		s.T().Errorf("incorrect count, wanted %d, got %d", len(birds), count)
+	}
+
+	// The birds were filled in with what they were created as, in order
+	for i, bird := range birds {
+		if bird.ID == 0 || bird.CreatedAt.IsZero() || bird.Species != fmt.Sprintf("species %d", i) {
+			s.T().Errorf("bird %d wasn't filled in: %+v", i, bird)
+		}
+	}
+}
+
+func (s *StoreSuite) TestCreateBirdsRollsBack() {
+	ctx := context.Background()
+	// The last bird breaks the description constraint of the table, after the
+	// others were inserted in earlier chunks
+	s.store.batchSize = 2
+	defer func() { s.store.batchSize = 0 }()
+
+	birds := []*Bird{
+		{Species: "eagle", Description: "batch"},
+		{Species: "robin", Description: "batch"},
+		{Species: "owl", Description: strings.Repeat("a", config.MaxDescriptionLength+1)},
+	}
+	if err := s.store.CreateBirds(ctx, birds); err == nil {
+		s.T().Fatal("expected an error for a description over the limit")
+	}
+
+	count, err := s.store.CountBirds(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if count != 0 {
+		s.T().Errorf("expected every insert to be rolled back, got %d birds", count)
+	}
+}
+
+func (s *StoreSuite) TestGetBird() {
+	ctx := context.Background()
+	// Insert a sample bird into the `birds` table
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES('bird','description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Get the list of birds through the stores `GetBirds` method
+	birds, err := s.store.GetBirds(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Assert that the count of birds received must be 1
+	nBirds := len(birds)
+	if nBirds != 1 {
+		s.T().Errorf("incorrect count, wanted 1, got %d", nBirds)
+	}
+
+	// Assert that the details of the bird is the same as the one we inserted
+	// (the ID and timestamps are filled in by the database, so we take them
+	// from the result)
+	expectedBird := Bird{ID: birds[0].ID, Species: "bird", Description: "description", CreatedAt: birds[0].CreatedAt, UpdatedAt: birds[0].UpdatedAt}
+	if *birds[0] != expectedBird {
+		s.T().Errorf("incorrect details, expected %v, got %v", expectedBird, *birds[0])
+	}
+}
+
+func (s *StoreSuite) TestGetBirdsNewestFirst() {
+	ctx := context.Background()
+	// The birds are inserted out of order, so that the IDs can't give the
+	// order away
+	_, err := s.db.Query(`INSERT INTO birds (species, description, created_at) VALUES
+		('middle', 'description', now() - interval '1 hour'),
+		('newest', 'description', now()),
+		('oldest', 'description', now() - interval '2 hours')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.GetBirds(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	species := []string{}
+	for _, bird := range birds {
+		species = append(species, bird.Species)
+	}
+	if strings.Join(species, ",") != "newest,middle,oldest" {
+		s.T().Errorf("expected the newest birds first, got %v", species)
+	}
+}
+
+func (s *StoreSuite) TestBirdsModifiedSince() {
+	ctx := context.Background()
+	// Insert three birds, each touched at a different point in time
+	_, err := s.db.Query(`INSERT INTO birds (species, description, updated_at) VALUES
+		('old', 'description', now() - interval '2 hours'),
+		('newer', 'description', now() - interval '30 minutes'),
+		('newest', 'description', now())`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Only the birds changed within the last hour should be returned, in the
+	// order they were changed
+	birds, err := s.store.BirdsModifiedSince(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 {
+		s.T().Fatalf("incorrect count, wanted 2, got %d", len(birds))
+	}
+	if birds[0].Species != "newer" || birds[1].Species != "newest" {
+		s.T().Errorf("incorrect birds, expected [newer newest], got [%s %s]", birds[0].Species, birds[1].Species)
+	}
+}
+
+func (s *StoreSuite) TestStaleBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description, created_at, updated_at) VALUES
+		('forgotten', 'description', now() - interval '60 days', now() - interval '40 days'),
+		('untouched', 'description', now() - interval '50 days', now() - interval '50 days'),
+		('revisited', 'description', now() - interval '60 days', now() - interval '1 day'),
+		('fresh', 'description', now(), now())`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Only the birds that haven't changed in a month are stale, whenever they
+	// were created, least recently changed first
+	birds, err := s.store.StaleBirds(ctx, time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 {
+		s.T().Fatalf("incorrect count, wanted 2, got %d", len(birds))
+	}
+	if birds[0].Species != "untouched" || birds[1].Species != "forgotten" {
+		s.T().Errorf("incorrect birds, expected [untouched forgotten], got [%s %s]", birds[0].Species, birds[1].Species)
+	}
+}
+
+func (s *StoreSuite) TestFindBirdsBySpecies() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('Golden Eagle', 'description'),
+		('bald eagle', 'description'),
+		('sparrow', 'description'),
+		('100% owl', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.FindBirdsBySpecies(ctx, "EAGLE")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 {
+		s.T().Fatalf("incorrect count, wanted 2, got %d", len(birds))
+	}
+
+	// Wildcards are matched literally
+	birds, err = s.store.FindBirdsBySpecies(ctx, "%")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 1 || birds[0].Species != "100% owl" {
+		s.T().Errorf("incorrect birds, expected [100%% owl], got %+v", birds)
+	}
+}
+
+func (s *StoreSuite) TestSearchBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('bald eagle', 'A bird of PREY'),
+		('golden eagle', 'Hunts in the mountains'),
+		('owl', 'A bird of prey that hunts at night'),
+		('sparrow', NULL)`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	tests := []struct {
+		species, keyword string
+		expected         []string
+	}{
+		{"", "prey", []string{"bald eagle", "owl"}},
+		{"EAGLE", "", []string{"bald eagle", "golden eagle"}},
+		{"eagle", "prey", []string{"bald eagle"}},
+		{"", "", []string{"bald eagle", "golden eagle", "owl", "sparrow"}},
+		{"", "100%", []string{}},
+	}
+	for _, tt := range tests {
+		birds, err := s.store.SearchBirds(ctx, tt.species, tt.keyword)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		species := []string{}
+		for _, bird := range birds {
+			species = append(species, bird.Species)
+		}
+		if !reflect.DeepEqual(species, tt.expected) {
+			s.T().Errorf("%q and %q: incorrect birds, wanted %v, got %v", tt.species, tt.keyword, tt.expected, species)
+		}
+	}
+}
+
+func (s *StoreSuite) TestIncrementViews() {
+	ctx := context.Background()
+	bird := &Bird{Species: "sparrow"}
+	if err := s.store.CreateBird(ctx, bird); err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Concurrent increments don't overwrite each other
+	const views = 20
+	var wg sync.WaitGroup
+	for i := 0; i < views; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.store.IncrementViews(ctx, bird.ID); err != nil {
+				s.T().Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var count int
+	if err := s.db.QueryRow("SELECT views FROM birds WHERE id = $1", bird.ID).Scan(&count); err != nil {
+		s.T().Fatal(err)
+	}
+	if count != views {
+		s.T().Errorf("incorrect views, wanted %d, got %d", views, count)
+	}
+
+	if err := s.store.IncrementViews(ctx, bird.ID+1); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestBirdsBySpeciesList() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('robin', 'description'),
+		('eagle', 'description'),
+		('sparrow', 'description'),
+		('robin redbreast', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.BirdsBySpeciesList(ctx, []string{"robin", "sparrow"})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	species := []string{}
+	for _, bird := range birds {
+		species = append(species, bird.Species)
+	}
+	if !reflect.DeepEqual(species, []string{"robin", "sparrow"}) {
+		s.T().Errorf("incorrect birds, expected [robin sparrow], got %v", species)
+	}
+}
+
+func (s *StoreSuite) TestCheckSchemaVersion() {
+	ctx := context.Background()
+	if err := checkSchemaVersion(ctx, s.store); err != nil {
+		s.T().Errorf("the migrated schema should be at the expected version: %v", err)
+	}
+
+	// A newer build migrated the database
+	if _, err := s.db.Exec("UPDATE schema_version SET version = $1", schemaVersion+1); err != nil {
+		s.T().Fatal(err)
+	}
+	defer s.db.Exec("UPDATE schema_version SET version = $1", schemaVersion)
+
+	if err := checkSchemaVersion(ctx, s.store); err == nil {
+		s.T().Errorf("expected an error for a mismatched schema version")
+	}
+}
+
+func (s *StoreSuite) TestFindFirst() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (id, species, description) VALUES
+		(2, 'sparrow', 'second'),
+		(1, 'eagle', 'first'),
+		(3, 'sparrow', 'third')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	bird, err := s.store.FindFirst(ctx, QueryOptions{Species: "sparrow"})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.ID != 2 {
+		s.T().Errorf("expected the sparrow with the lowest ID, got %+v", bird)
+	}
+
+	if _, err := s.store.FindFirst(ctx, QueryOptions{Species: "dodo"}); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestDeleteBirdsMatching() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('dodo', 'description'),
+		('dodo bird', 'description'),
+		('sparrow', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	deleted, err := s.store.DeleteBirdsMatching(ctx, QueryOptions{Species: "dodo"})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if deleted != 1 {
+		s.T().Errorf("incorrect count, wanted 1 deleted, got %d", deleted)
+	}
+
+	// Only the birds of the species are gone
+	birds, err := s.store.GetBirds(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 {
+		s.T().Errorf("incorrect count, wanted 2 birds left, got %d", len(birds))
+	}
+	for _, bird := range birds {
+		if bird.Species == "dodo" {
+			s.T().Errorf("a matching bird was left: %+v", bird)
+		}
+	}
+
+	// A filter is required
+	if _, err := s.store.DeleteBirdsMatching(ctx, QueryOptions{}); err != errEmptyFilter {
+		s.T().Errorf("expected errEmptyFilter, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestFullTextSearch() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('swift', 'Flying for months without landing'),
+		('kiwi', 'Cannot fly at all'),
+		('penguin', 'Swims in cold water')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// "flies" is stemmed to the same word as "flying" and "fly", so both of
+	// the birds mentioning flight should match
+	birds, err := s.store.FullTextSearch(ctx, "flies")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 {
+		s.T().Fatalf("incorrect count, wanted 2, got %d", len(birds))
+	}
+	for _, bird := range birds {
+		if bird.Species == "penguin" {
+			s.T().Errorf("unexpected match %v", *bird)
+		}
+	}
+
+	// Queries are plain text: every word has to match, and punctuation isn't
+	// parsed as tsquery syntax
+	for query, want := range map[string]int{"cold water": 1, "swims & flies": 0, "cold, water!": 1} {
+		birds, err := s.store.FullTextSearch(ctx, query)
+		if err != nil {
+			s.T().Fatalf("%q: %v", query, err)
+		}
+		if len(birds) != want {
+			s.T().Errorf("%q: incorrect count, wanted %d, got %d", query, want, len(birds))
+		}
+	}
+}
+
+func (s *StoreSuite) TestGetBirdByID() {
+	ctx := context.Background()
+	var id int
+	err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES('bird','description') RETURNING id`).Scan(&id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	bird, err := s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.ID != id || bird.Species != "bird" || bird.Description != "description" {
+		s.T().Errorf("incorrect details, got %v", *bird)
+	}
+
+	// An ID that doesn't exist should be reported as such
+	if _, err := s.store.GetBirdByID(ctx, id+1); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestConnectionInitSQL() {
+	db, err := openDB(testConnString, []string{"SET TIME ZONE 'Pacific/Auckland'"})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	defer db.Close()
+
+	// The session setting should have been applied on the new connection
+	var timezone string
+	if err := db.QueryRow("SHOW TIME ZONE").Scan(&timezone); err != nil {
+		s.T().Fatal(err)
+	}
+	if timezone != "Pacific/Auckland" {
+		s.T().Errorf("incorrect time zone, wanted Pacific/Auckland, got %s", timezone)
+	}
+}
+
+func (s *StoreSuite) TestFirstAndLastBird() {
+	ctx := context.Background()
+	// With no birds, there is neither a first nor a last one
+	first, last, err := s.store.FirstAndLastBird(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if first != nil || last != nil {
+		s.T().Errorf("expected no birds, got %v and %v", first, last)
+	}
+
+	_, err = s.db.Query(`INSERT INTO birds (species, description, created_at) VALUES
+		('middle', 'description', now() - interval '1 day'),
+		('newest', 'description', now()),
+		('oldest', 'description', now() - interval '2 days')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	first, last, err = s.store.FirstAndLastBird(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if first == nil || first.Species != "oldest" {
+		s.T().Errorf("incorrect first bird, wanted oldest, got %v", first)
+	}
+	if last == nil || last.Species != "newest" {
+		s.T().Errorf("incorrect last bird, wanted newest, got %v", last)
+	}
+}
+
+func (s *StoreSuite) TestCountsByDay() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description, created_at) VALUES
+		('a', 'description', '2019-01-01 10:00:00+00'),
+		('b', 'description', '2019-01-02 09:00:00+00'),
+		('c', 'description', '2019-01-02 18:00:00+00'),
+		('d', 'description', '2019-01-04 12:00:00+00')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// The bird on the 4th falls outside of the range, and days without any
+	// birds are left out
+	counts, err := s.store.CountsByDay(ctx,
+		time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 1, 4, 0, 0, 0, 0, time.UTC),
+	)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	expected := map[string]int{"2019-01-01": 1, "2019-01-02": 2}
+	if !reflect.DeepEqual(counts, expected) {
+		s.T().Errorf("incorrect counts, wanted %v, got %v", expected, counts)
+	}
+}
+
+func (s *StoreSuite) TestGetBirdForUpdate() {
+	var id int
+	err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES('bird','') RETURNING id`).Scan(&id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// appendToDescription is a read-modify-write of the bird. `locked` is
+	// closed once the bird has been read and locked, and the update waits for
+	// `proceed` before writing
+	appendToDescription := func(suffix string, locked chan<- struct{}, proceed <-chan struct{}) error {
+		ctx := context.Background()
+		return s.store.withTx(ctx, func(tx *sql.Tx) error {
+			bird, err := s.store.GetBirdForUpdate(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if locked != nil {
+				close(locked)
+			}
+			if proceed != nil {
+				<-proceed
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE birds SET description = $1 WHERE id = $2", bird.Description+suffix, id)
+			return err
+		})
+	}
+
+	// The first update locks the bird, and holds on to the lock while the
+	// second one tries to read it
+	locked := make(chan struct{})
+	proceed := make(chan struct{})
+	firstDone := make(chan error)
+	go func() { firstDone <- appendToDescription("a", locked, proceed) }()
+	<-locked
+
+	secondDone := make(chan error)
+	go func() { secondDone <- appendToDescription("b", nil, nil) }()
+
+	// The second update can't finish while the first one holds the lock
+	select {
+	case err := <-secondDone:
+		s.T().Fatalf("second update finished while the bird was locked: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(proceed)
+	if err := <-firstDone; err != nil {
+		s.T().Fatal(err)
+	}
+	if err := <-secondDone; err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Since the second update read the bird after the first one committed,
+	// neither change was lost
+	bird, err := s.store.GetBirdByID(context.Background(), id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Description != "ab" {
+		s.T().Errorf("incorrect description, wanted ab, got %s", bird.Description)
+	}
+}
+
+func (s *StoreSuite) TestBirdsByInitial() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('Sparrow', 'description'),
+		('swift', 'description'),
+		('eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// The letter should match regardless of its case
+	birds, err := s.store.BirdsByInitial(ctx, "s")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "Sparrow" || birds[1].Species != "swift" {
+		s.T().Errorf("incorrect birds, wanted Sparrow and swift, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestSpeciesInitials() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('Swift', 'description'),
+		('eagle', 'description'),
+		('', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Each letter should appear once, in upper case, whatever the case of
+	// the species
+	initials, err := s.store.SpeciesInitials(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	expected := []string{"E", "S"}
+	if !reflect.DeepEqual(initials, expected) {
+		s.T().Errorf("incorrect initials, wanted %v, got %v", expected, initials)
+	}
+}
+
+func (s *StoreSuite) TestSpeciesCounts() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description'),
+		('Sparrow', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Species are counted as they are written
+	counts, err := s.store.SpeciesCounts(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	expected := map[string]int{"sparrow": 1, "Sparrow": 1, "eagle": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		s.T().Errorf("incorrect counts, wanted %v, got %v", expected, counts)
+	}
+}
+
+func (s *StoreSuite) TestDescriptionLengthConstraint() {
+	ctx := context.Background()
+	// A description at the configured limit is accepted...
+	atLimit := strings.Repeat("a", config.MaxDescriptionLength)
+	if err := s.store.CreateBird(ctx, &Bird{Species: "bird", Description: atLimit}); err != nil {
+		s.T().Errorf("description at the limit was rejected: %v", err)
+	}
+
+	// ...but the database refuses anything longer, just like the API does
+	overLimit := atLimit + "a"
+	if err := s.store.CreateBird(ctx, &Bird{Species: "another bird", Description: overLimit}); err == nil {
+		s.T().Error("description over the limit was accepted")
+	}
+	if err := (&Bird{Species: "bird", Description: overLimit}).validate(); err == nil {
+		s.T().Error("validate accepted a description the database refuses")
+	}
+}
+
+func (s *StoreSuite) TestDescriptionLengthConstraintKept() {
+	// constraintOID identifies the constraint, which changes when it is
+	// dropped and added again
+	constraintOID := func() int {
+		var oid int
+		err := s.db.QueryRow(`SELECT oid FROM pg_constraint WHERE conname = 'birds_description_length'`).Scan(&oid)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		return oid
+	}
+	migrate := func() {
+		if _, err := s.db.Exec(schemaSQL()); err != nil {
+			s.T().Fatal(err)
+		}
+	}
+
+	// Migrating again with the same settings leaves the constraint alone...
+	before := constraintOID()
+	migrate()
+	if after := constraintOID(); after != before {
+		s.T().Errorf("the constraint was replaced although the limit didn't change")
+	}
+
+	// ...but a new limit replaces it
+	defer func(old int) {
+		config.MaxDescriptionLength = old
+		migrate()
+	}(config.MaxDescriptionLength)
+	config.MaxDescriptionLength++
+	migrate()
+	if after := constraintOID(); after == before {
+		s.T().Errorf("the constraint wasn't replaced for a new limit")
+	}
+}
+
+func (s *StoreSuite) TestCountBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	count, err := s.store.CountBirds(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if count != 2 {
+		s.T().Errorf("incorrect count, wanted 2, got %d", count)
+	}
+}
+
+func (s *StoreSuite) TestMaxBirdID() {
+	ctx := context.Background()
+	// An empty table has no highest ID
+	id, err := s.store.MaxBirdID(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if id != 0 {
+		s.T().Errorf("incorrect max ID for no birds, wanted 0, got %d", id)
+	}
+
+	_, err = s.db.Query(`INSERT INTO birds (id, species, description) VALUES
+		(3, 'sparrow', 'description'),
+		(7, 'eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	id, err = s.store.MaxBirdID(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if id != 7 {
+		s.T().Errorf("incorrect max ID, wanted 7, got %d", id)
+	}
+}
+
+func (s *StoreSuite) TestBirdsAfter() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (id, species, description) VALUES
+		(1, 'sparrow', 'description'),
+		(4, 'eagle', 'description'),
+		(6, 'robin', 'description'),
+		(9, 'owl', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.BirdsAfter(ctx, 1, 2)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].ID != 4 || birds[1].ID != 6 {
+		s.T().Errorf("incorrect birds, wanted IDs [4 6], got %+v", birds)
+	}
+
+	birds, err = s.store.BirdsAfter(ctx, 9, 2)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 0 {
+		s.T().Errorf("expected no birds after the last one, got %+v", birds)
+	}
+}
+
+func (s *StoreSuite) TestGetBirdsPage() {
+	ctx := context.Background()
+	birds := []*Bird{}
+	for i := 0; i < 5; i++ {
+		birds = append(birds, &Bird{Species: fmt.Sprintf("species %d", i), Description: "description"})
+	}
+	if err := s.store.CreateBirds(ctx, birds); err != nil {
+		s.T().Fatal(err)
+	}
+
+	// The first two pages of two birds leave more birds to fetch...
+	page, err := s.store.GetBirdsPage(ctx, 2, 2)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Total != 5 || !page.HasNext {
+		s.T().Errorf("unexpected middle page: %+v", page)
+	}
+
+	// ...but the last one, with the fifth bird, doesn't
+	page, err = s.store.GetBirdsPage(ctx, 2, 4)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Species != "species 4" || page.HasNext {
+		s.T().Errorf("unexpected last page: %+v", page)
+	}
+}
+
+func (s *StoreSuite) TestGetBirdsPageWithFacets() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description'),
+		('swift', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// The facets count every bird, and not only the one of the page
+	page, err := s.store.GetBirdsPageWithFacets(ctx, QueryOptions{}, 1, 1)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Species != "eagle" || page.Total != 3 || !page.HasNext {
+		s.T().Errorf("unexpected page: %+v", page.Page)
+	}
+	if !reflect.DeepEqual(page.Facets.Species, map[string]int{"sparrow": 1, "eagle": 1, "swift": 1}) {
+		s.T().Errorf("unexpected facets: %v", page.Facets.Species)
+	}
+
+	// A filter narrows the facets down too
+	page, err = s.store.GetBirdsPageWithFacets(ctx, QueryOptions{Species: "swift"}, 10, 0)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if page.Total != 1 || !reflect.DeepEqual(page.Facets.Species, map[string]int{"swift": 1}) {
+		s.T().Errorf("unexpected filtered page: %+v, with facets %v", page.Page, page.Facets.Species)
+	}
+}
+
+func (s *StoreSuite) TestBirdsByDescriptionLength() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('stub', ''),
+		('short', 'small'),
+		('medium', 'a small bird with a long tail'),
+		('accented', 'rougegorge à gorge')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// The bounds are included, and the length is counted in characters, not
+	// bytes
+	birds, err := s.store.BirdsByDescriptionLength(ctx, 5, 18)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "short" || birds[1].Species != "accented" {
+		s.T().Errorf("incorrect birds, wanted short and accented, got %v", birds)
+	}
+
+	birds, err = s.store.BirdsByDescriptionLength(ctx, 0, 0)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 1 || birds[0].Species != "stub" {
+		s.T().Errorf("incorrect birds, wanted stub, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestEachBird() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	species := []string{}
+	err = s.store.EachBird(ctx, func(bird *Bird) error {
+		species = append(species, bird.Species)
+		return nil
+	})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if !reflect.DeepEqual(species, []string{"sparrow", "eagle"}) {
+		s.T().Errorf("incorrect birds, wanted sparrow and eagle, got %v", species)
+	}
+}
+
+func (s *StoreSuite) TestEachBirdSnapshot() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Change the birds while the export is running: the export should still
+	// see them as they were when it started
+	species := []string{}
+	err = s.store.EachBird(ctx, func(bird *Bird) error {
+		if len(species) == 0 {
+			if _, err := s.db.Exec(`UPDATE birds SET species = 'golden eagle' WHERE species = 'eagle'`); err != nil {
+				return err
+			}
+			if _, err := s.db.Exec(`INSERT INTO birds (species, description) VALUES ('robin', 'description')`); err != nil {
+				return err
+			}
+		}
+		species = append(species, bird.Species)
+		return nil
+	})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if !reflect.DeepEqual(species, []string{"sparrow", "eagle"}) {
+		s.T().Errorf("incorrect birds, wanted the snapshot [sparrow eagle], got %v", species)
+	}
+}
+
+// importConflictFixture creates bird 1, and returns an import that conflicts
+// with it, along with a new bird 2
+func (s *StoreSuite) importConflictFixture() []*Bird {
+	_, err := s.db.Query(`INSERT INTO birds (id, species, description) VALUES (1, 'sparrow', 'original')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	return []*Bird{
+		{ID: 1, Species: "sparrow", Description: "imported"},
+		{ID: 2, Species: "eagle", Description: "imported"},
+	}
+}
+
+func (s *StoreSuite) TestImportBirdsSkip() {
+	ctx := context.Background()
+	birds := s.importConflictFixture()
+
+	outcomes, err := s.store.ImportBirds(ctx, birds, ConflictSkip)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if !reflect.DeepEqual(outcomes, []ImportOutcome{ImportSkipped, ImportCreated}) {
+		s.T().Errorf("incorrect outcomes: %v", outcomes)
+	}
+	bird, err := s.store.GetBirdByID(ctx, 1)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Description != "original" {
+		s.T().Errorf("skipped bird was changed to %+v", bird)
+	}
+}
+
+func (s *StoreSuite) TestImportBirdsOverwrite() {
+	ctx := context.Background()
+	birds := s.importConflictFixture()
+
+	outcomes, err := s.store.ImportBirds(ctx, birds, ConflictOverwrite)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if !reflect.DeepEqual(outcomes, []ImportOutcome{ImportOverwritten, ImportCreated}) {
+		s.T().Errorf("incorrect outcomes: %v", outcomes)
+	}
+	bird, err := s.store.GetBirdByID(ctx, 1)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Description != "imported" {
+		s.T().Errorf("overwritten bird wasn't changed: %+v", bird)
+	}
+
+	// New birds should be given IDs after the imported ones
+	if err := s.store.CreateBird(ctx, &Bird{Species: "swift", Description: "new"}); err != nil {
+		s.T().Errorf("creating a bird after the import failed: %v", err)
+	}
+}
+
+func (s *StoreSuite) TestImportBirdsError() {
+	ctx := context.Background()
+	birds := s.importConflictFixture()
+
+	_, err := s.store.ImportBirds(ctx, birds, ConflictError)
+	if !errors.Is(err, ErrBirdExists) {
+		s.T().Errorf("expected ErrBirdExists, got %v", err)
+	}
+	// Nothing should have been imported, not even the bird without conflict
+	if _, err := s.store.GetBirdByID(ctx, 2); err != ErrBirdNotFound {
+		s.T().Errorf("expected the import to be rolled back, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestRecentBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description, created_at) VALUES
+		('sparrow', 'description', '2019-01-01T00:00:00Z'),
+		('eagle', 'description', '2019-01-03T00:00:00Z'),
+		('swift', 'description', '2019-01-02T00:00:00Z')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.RecentBirds(ctx, 2)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "eagle" || birds[1].Species != "swift" {
+		s.T().Errorf("incorrect birds, wanted eagle and swift, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestTopBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description, views) VALUES
+		('sparrow', 'description', 2),
+		('eagle', 'description', 5),
+		('swift', 'description', 0),
+		('owl', 'description', 2)`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	birds, err := s.store.TopBirds(ctx, 3)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 3 || birds[0].Species != "eagle" || birds[1].Species != "sparrow" || birds[2].Species != "owl" {
+		s.T().Errorf("incorrect birds, wanted eagle, sparrow and owl, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestUpdateColumns() {
+	ctx := context.Background()
+	var id int
+	err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES ('sparrow', 'description') RETURNING id`).Scan(&id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Only the given column should change
+	if err := s.store.UpdateColumns(ctx, id, map[string]any{"description": "A small harmless bird"}); err != nil {
+		s.T().Fatal(err)
+	}
+	bird, err := s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Species != "sparrow" || bird.Description != "A small harmless bird" {
+		s.T().Errorf("incorrect bird after the update: %+v", bird)
+	}
+	if !bird.UpdatedAt.After(bird.CreatedAt) {
+		s.T().Errorf("updated_at wasn't changed by the update: %+v", bird)
+	}
+
+	if err := s.store.UpdateColumns(ctx, id+1, map[string]any{"species": "eagle"}); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestUpdateColumnsUnknownColumn() {
+	ctx := context.Background()
+	var id int
+	err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES ('sparrow', 'description') RETURNING id`).Scan(&id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// A column outside of the allowlist should reject the whole update
+	err = s.store.UpdateColumns(ctx, id, map[string]any{"species": "eagle", "created_at": "2019-01-01"})
+	if err == nil {
+		s.T().Fatal("update of an unknown column was accepted")
+	}
+	bird, err := s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Species != "sparrow" {
+		s.T().Errorf("rejected update changed the bird: %+v", bird)
+	}
+}
+
+func (s *StoreSuite) TestRecentlyUpdated() {
+	ctx := context.Background()
+	ids := map[string]int{}
+	for _, species := range []string{"sparrow", "eagle", "swift"} {
+		var id int
+		err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES ($1, 'description') RETURNING id`, species).Scan(&id)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		ids[species] = id
+	}
+
+	// Update the birds in another order than they were created in
+	for _, species := range []string{"eagle", "sparrow"} {
+		if err := s.store.UpdateColumns(ctx, ids[species], map[string]any{"description": "updated"}); err != nil {
+			s.T().Fatal(err)
+		}
+	}
+
+	birds, err := s.store.RecentlyUpdated(ctx, 2)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "sparrow" || birds[1].Species != "eagle" {
+		s.T().Errorf("incorrect birds, wanted sparrow and eagle, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestBirdsMissingDescription() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'A small harmless bird'),
+		('eagle', ''),
+		('swift', NULL)`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Both empty and missing descriptions count, but complete birds don't
+	birds, err := s.store.BirdsMissingDescription(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "eagle" || birds[1].Species != "swift" {
+		s.T().Errorf("incorrect birds, wanted eagle and swift, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestReplaceDescription() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'TBD'),
+		('eagle', 'A bird of prey'),
+		('swift', 'TBD'),
+		('owl', 'TBD later')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	updated, err := s.store.ReplaceDescription(ctx, "TBD", "")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if updated != 2 {
+		s.T().Errorf("incorrect count, wanted 2, got %d", updated)
+	}
+
+	// Only descriptions that are exactly the placeholder should have changed
+	birds, err := s.store.BirdsMissingDescription(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if len(birds) != 2 || birds[0].Species != "sparrow" || birds[1].Species != "swift" {
+		s.T().Errorf("incorrect birds, wanted sparrow and swift, got %v", birds)
+	}
+}
+
+func (s *StoreSuite) TestDatasetChecksum() {
+	ctx := context.Background()
+	if err := s.store.CreateBird(ctx, &Bird{Species: "sparrow", Description: "description"}); err != nil {
+		s.T().Fatal(err)
+	}
+
+	checksum, err := s.store.DatasetChecksum(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	// Without any change, the checksum should stay the same...
+	again, err := s.store.DatasetChecksum(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if again != checksum {
+		s.T().Errorf("checksum changed from %s to %s without any change", checksum, again)
+	}
+
+	// ...and a new bird should change it
+	if err := s.store.CreateBird(ctx, &Bird{Species: "eagle", Description: "description"}); err != nil {
+		s.T().Fatal(err)
+	}
+	after, err := s.store.DatasetChecksum(ctx)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if after == checksum {
+		s.T().Errorf("checksum %s didn't change after a bird was created", checksum)
+	}
+}
+
+func (s *StoreSuite) TestUpdateBird() {
+	ctx := context.Background()
+	created := &Bird{Species: "sparrow", Description: "description"}
+	if err := s.store.CreateBird(ctx, created); err != nil {
+		s.T().Fatal(err)
+	}
+	birds, err := s.store.GetBirds(ctx)
+	if err != nil || len(birds) != 1 {
+		s.T().Fatalf("expected the created bird, got %v (%v)", birds, err)
+	}
+	id := birds[0].ID
+
+	bird := &Bird{Species: "eagle", Description: "A bird of prey"}
+	if err := s.store.UpdateBird(ctx, id, bird); err != nil {
+		s.T().Fatal(err)
+	}
+	// The bird given to the store should now be the whole updated bird
+	if bird.ID != id || bird.Species != "eagle" || bird.CreatedAt.IsZero() {
+		s.T().Errorf("incorrect updated bird: %+v", bird)
+	}
+	stored, err := s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if stored.Species != "eagle" || stored.Description != "A bird of prey" {
+		s.T().Errorf("the update wasn't stored: %+v", stored)
+	}
+
+	if err := s.store.UpdateBird(ctx, id+1, &Bird{Species: "owl"}); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestUpdateBirdVersion() {
+	ctx := context.Background()
+	created := &Bird{Species: "sparrow", Description: "description"}
+	if err := s.store.CreateBird(ctx, created); err != nil {
+		s.T().Fatal(err)
+	}
+	if created.Version != 1 {
+		s.T().Errorf("expected a new bird to be at version 1, got %d", created.Version)
+	}
+
+	bird := &Bird{Species: "robin", Version: 1}
+	if err := s.store.UpdateBird(ctx, created.ID, bird); err != nil {
+		s.T().Fatal(err)
+	}
+	if bird.Version != 2 {
+		s.T().Errorf("expected version 2 after an update, got %d", bird.Version)
+	}
+
+	// An update based on the first version comes too late
+	if err := s.store.UpdateBird(ctx, created.ID, &Bird{Species: "eagle", Version: 1}); err != ErrVersionConflict {
+		s.T().Errorf("expected ErrVersionConflict, got %v", err)
+	}
+	stored, err := s.store.GetBirdByID(ctx, created.ID)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if stored.Species != "robin" || stored.Version != 2 {
+		s.T().Errorf("the conflicting update should not be stored: %+v", stored)
+	}
+	if err := s.store.UpdateBird(ctx, created.ID+1, &Bird{Species: "eagle", Version: 1}); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestUpdateBirdConcurrentVersion() {
+	ctx := context.Background()
+	created := &Bird{Species: "sparrow", Description: "description"}
+	if err := s.store.CreateBird(ctx, created); err != nil {
+		s.T().Fatal(err)
+	}
+
+	// Updates based on the same version race each other. The bird is locked
+	// while its version is checked, so only one of them can win
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.store.UpdateBird(ctx, created.ID, &Bird{Species: fmt.Sprintf("species %d", i), Version: 1})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	updated := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			updated++
+		case ErrVersionConflict:
+		default:
+			s.T().Errorf("unexpected error: %v", err)
+		}
+	}
+	if updated != 1 {
+		s.T().Errorf("expected exactly one update to succeed, got %d", updated)
+	}
+}
+
+func (s *StoreSuite) TestPatchBird() {
+	ctx := context.Background()
+	created := &Bird{Species: "sparrow", Description: "description"}
+	if err := s.store.CreateBird(ctx, created); err != nil {
+		s.T().Fatal(err)
+	}
+	birds, err := s.store.GetBirds(ctx)
+	if err != nil || len(birds) != 1 {
+		s.T().Fatalf("expected the created bird, got %v (%v)", birds, err)
+	}
+	id := birds[0].ID
+
+	// Only the description is changed...
+	description := "A small harmless bird"
+	if err := s.store.PatchBird(ctx, id, nil, &description); err != nil {
+		s.T().Fatal(err)
+	}
+	stored, err := s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if stored.Species != "sparrow" || stored.Description != description {
+		s.T().Errorf("incorrect patched bird: %+v", stored)
+	}
+
+	// ...and then only the species
+	species := "robin"
+	if err := s.store.PatchBird(ctx, id, &species, nil); err != nil {
+		s.T().Fatal(err)
+	}
+	stored, err = s.store.GetBirdByID(ctx, id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	if stored.Species != "robin" || stored.Description != description {
+		s.T().Errorf("incorrect patched bird: %+v", stored)
+	}
+
+	if err := s.store.PatchBird(ctx, id, nil, nil); err != errEmptyPatch {
+		s.T().Errorf("expected errEmptyPatch, got %v", err)
+	}
+	if err := s.store.PatchBird(ctx, id+1, &species, nil); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestDeleteBird() {
+	ctx := context.Background()
+	var id int
+	err := s.db.QueryRow(`INSERT INTO birds (species, description) VALUES ('sparrow', 'description') RETURNING id`).Scan(&id)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	if err := s.store.DeleteBird(ctx, id); err != nil {
+		s.T().Fatal(err)
+	}
+	if _, err := s.store.GetBirdByID(ctx, id); err != ErrBirdNotFound {
+		s.T().Errorf("the bird should be gone, got %v", err)
+	}
+
+	// It can't be deleted twice
+	if err := s.store.DeleteBird(ctx, id); err != ErrBirdNotFound {
+		s.T().Errorf("expected ErrBirdNotFound, got %v", err)
+	}
+}
+
+func (s *StoreSuite) TestDeleteAllBirds() {
+	ctx := context.Background()
+	_, err := s.db.Query(`INSERT INTO birds (species, description) VALUES
+		('sparrow', 'description'),
+		('eagle', 'description')`)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+
+	if err := s.store.DeleteAllBirds(ctx); err != nil {
+		s.T().Fatal(err)
+	}
+	if count, err := s.store.CountBirds(ctx); err != nil || count != 0 {
+		s.T().Errorf("expected no birds left, got %d (%v)", count, err)
+	}
+}
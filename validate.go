@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is a rule that a field of a payload breaks, such as a species
+// that is too long
+type FieldError struct {
+	// Index is the position of the payload in a batch, such as the birds of
+	// `POST /birds`, and is left out for a single payload
+	Index *int `json:"index,omitempty"`
+	// Field is the name of the field in the JSON payload
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors are every rule broken by a payload, so that clients can
+// fix them all at once, instead of one request at a time
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+		if err.Index != nil {
+			messages[i] = fmt.Sprintf("bird %d: %s", *err.Index, err.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// atIndex gives the rules broken by the payload at `index` of a batch its
+// position, so that they can be reported along with those of the others
+func (errs ValidationErrors) atIndex(index int) ValidationErrors {
+	indexed := make(ValidationErrors, len(errs))
+	for i, err := range errs {
+		err.Index = &index
+		indexed[i] = err
+	}
+	return indexed
+}
+
+// payloadValidator checks the payloads against the rules of their `validate`
+// struct tags. On top of the rules of the validator package, it knows:
+//   - notblank, for strings with more than whitespace
+//   - maxdescription, for strings no longer than the configured
+//     `MaxDescriptionLength`, which a fixed `max` couldn't follow
+var payloadValidator = newPayloadValidator()
+
+func newPayloadValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// The errors name the fields like clients do, as in "species"
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterValidation("maxdescription", func(fl validator.FieldLevel) bool {
+		return utf8.RuneCountInString(fl.Field().String()) <= config.MaxDescriptionLength
+	})
+	return v
+}
+
+// validatePayload checks `payload` against the rules of its struct tags, and
+// returns the broken ones as ValidationErrors. Each field breaks at most one
+// rule, the first one of its tag
+func validatePayload(payload interface{}) error {
+	err := payloadValidator.Struct(payload)
+	failures, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+	errs := make(ValidationErrors, len(failures))
+	for i, failure := range failures {
+		errs[i] = FieldError{Field: failure.Field(), Message: fieldErrorMessage(failure)}
+	}
+	return errs
+}
+
+// fieldErrorMessage describes a broken rule for clients
+func fieldErrorMessage(failure validator.FieldError) string {
+	switch failure.Tag() {
+	case "required", "notblank":
+		return fmt.Sprintf("%s must not be blank", failure.Field())
+	case "max":
+		n := utf8.RuneCountInString(fmt.Sprint(failure.Value()))
+		return fmt.Sprintf("%s is %d characters long, but can be at most %s", failure.Field(), n, failure.Param())
+	case "maxdescription":
+		n := utf8.RuneCountInString(fmt.Sprint(failure.Value()))
+		return fmt.Sprintf("%s is %d characters long, but can be at most %d", failure.Field(), n, config.MaxDescriptionLength)
+	default:
+		return fmt.Sprintf("%s is invalid", failure.Field())
+	}
+}
+
+// writeValidationErrors responds with 422 Unprocessable Entity, and every
+// rule that the payload breaks, as in
+// `{"error":"species must not be blank","errors":[{"field":"species",...}]}`.
+// The `error` sums them up, like for the other errors of the API
+func writeValidationErrors(w http.ResponseWriter, err error) {
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType())
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": errs.Error(), "errors": errs})
+}
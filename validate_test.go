@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateBirdHandlerValidationErrors(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("CreateBird", &Bird{Species: "eagle", Description: "A bird of prey"}).Return(nil).Once()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedErrors ValidationErrors
+	}{
+		{"valid", `{"species":"eagle","description":"A bird of prey"}`, http.StatusCreated, nil},
+		// Every broken rule is reported at once
+		{"several fields", `{"species":"` + strings.Repeat("a", maxSpeciesLength+1) + `","description":"` + strings.Repeat("b", config.MaxDescriptionLength+1) + `"}`,
+			http.StatusUnprocessableEntity, ValidationErrors{
+				{Field: "species", Message: "species is 101 characters long, but can be at most 100"},
+				{Field: "description", Message: "description is 501 characters long, but can be at most 500"},
+			}},
+		{"blank species", `{"species":"  ","description":"A bird of prey"}`, http.StatusUnprocessableEntity, ValidationErrors{
+			{Field: "species", Message: "species must not be blank"},
+		}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/bird", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		recorder := httptest.NewRecorder()
+		http.HandlerFunc(srv.createBirdHandler).ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != tt.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", tt.name, status, tt.expectedStatus)
+			continue
+		}
+		if tt.expectedErrors == nil {
+			continue
+		}
+		var body struct {
+			Error  string           `json:"error"`
+			Errors ValidationErrors `json:"errors"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(body.Errors, tt.expectedErrors) {
+			t.Errorf("%s: unexpected errors, got %+v want %+v", tt.name, body.Errors, tt.expectedErrors)
+		}
+		if body.Error != tt.expectedErrors.Error() {
+			t.Errorf("%s: the error should sum up the others, got %q", tt.name, body.Error)
+		}
+	}
+
+	mockStore.AssertExpectations(t)
+}
+
+func TestCreateBirdsHandlerValidationErrors(t *testing.T) {
+	// None of the birds reach the store when one of them is invalid
+	srv := newServer(InitMockStore())
+
+	body := `[{"species":" "},{"species":"eagle"},{"species":"robin","description":"` + strings.Repeat("b", config.MaxDescriptionLength+1) + `"}]`
+	req := httptest.NewRequest("POST", "/birds", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(srv.createBirdsHandler).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+	var response struct {
+		Error  string           `json:"error"`
+		Errors ValidationErrors `json:"errors"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	// Every invalid bird is reported, with its position in the batch
+	first, third := 0, 2
+	expected := ValidationErrors{
+		{Index: &first, Field: "species", Message: "species must not be blank"},
+		{Index: &third, Field: "description", Message: "description is 501 characters long, but can be at most 500"},
+	}
+	if !reflect.DeepEqual(response.Errors, expected) {
+		t.Errorf("unexpected errors, got %+v want %+v", response.Errors, expected)
+	}
+	if summary := "bird 0: species must not be blank; bird 2: description is 501 characters long, but can be at most 500"; response.Error != summary {
+		t.Errorf("the error should sum up the others, got %q want %q", response.Error, summary)
+	}
+}
+
+func TestUpdateBirdHandlerValidationErrors(t *testing.T) {
+	mockStore := InitMockStore()
+	router := newRouter(newServer(mockStore))
+
+	req := httptest.NewRequest("PUT", "/bird/3", strings.NewReader(`{"species":"","description":"`+strings.Repeat("b", config.MaxDescriptionLength+1)+`"}`))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+	var body struct {
+		Errors ValidationErrors `json:"errors"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Errors) != 2 || body.Errors[0].Field != "species" || body.Errors[1].Field != "description" {
+		t.Errorf("expected errors for the species and the description, got %+v", body.Errors)
+	}
+	mockStore.AssertNotCalled(t, "UpdateBird")
+}
+
+func TestValidateFollowsDescriptionLimit(t *testing.T) {
+	defer func(old Config) { config = old }(config)
+	config.MaxDescriptionLength = 10
+
+	err := (&Bird{Species: "eagle", Description: "A bird of prey"}).validate()
+	expected := ValidationErrors{{Field: "description", Message: "description is 14 characters long, but can be at most 10"}}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected the configured limit to be checked, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "net/http"
+
+// The build of the server is described by these variables, which are set by
+// the linker when releasing, as in:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds made without the flags, such as during development, keep the
+// defaults
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// buildInfo is the body of `/version`
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+}
+
+// versionHandler responds with the build of the server, so that operators can
+// check which one is deployed
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, buildInfo{Version: version, Commit: commit, BuildTime: buildTime})
+}
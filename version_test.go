@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/version", nil)
+	recorder := httptest.NewRecorder()
+	newRouter(newServer(nil)).ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("handler returned wrong content type: %q", contentType)
+	}
+	// Without linker flags, the defaults are reported
+	expected := `{"version":"dev","commit":"unknown","buildTime":"unknown"}`
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", body, expected)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// birdMediaTypes are the types that the bird endpoints can respond with. Some
+// older integrations can only read XML
+var birdMediaTypes = []string{"application/json", "application/xml"}
+
+// xmlBirds is the root element of a list of birds in XML, as in
+// `<birds><bird>...</bird></birds>`
+type xmlBirds struct {
+	XMLName xml.Name `xml:"birds"`
+	Birds   []*Bird  `xml:"bird"`
+}
+
+// prefersXML tells if the client asked for XML, rather than JSON, in the
+// `Accept` header. XML has to be named explicitly, and be preferred over JSON,
+// so that a missing header, `*/*` or a tie all get JSON
+func prefersXML(r *http.Request) bool {
+	var xmlQ, jsonQ float64
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+		switch t {
+		case "application/xml", "text/xml":
+			if q > xmlQ {
+				xmlQ = q
+			}
+		case "application/json":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		}
+	}
+	return xmlQ > jsonQ
+}
+
+// writeXML writes `v` as the XML body of a successful response. Like with
+// `writeJSON`, the client gets a server error if it can't be converted
+func writeXML(w http.ResponseWriter, v interface{}) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		fmt.Println(fmt.Errorf("Error: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, errInternal.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(body)
+}
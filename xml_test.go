@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBirdsContentNegotiation(t *testing.T) {
+	mockStore := InitMockStore()
+	srv := newServer(mockStore)
+	mockStore.On("GetBirds").Return([]*Bird{{ID: 1, Species: "sparrow", Description: "A small harmless bird"}}, nil)
+	mockStore.On("GetBirdByID", 1).Return(&Bird{ID: 1, Species: "sparrow", Description: "A small harmless bird"}, nil)
+	mockStore.On("IncrementViews", 1).Return(nil)
+
+	router := newRouter(srv)
+
+	tests := []struct {
+		path                string
+		accept              string
+		expectedContentType string
+	}{
+		{"/bird", "", "application/json"},
+		{"/bird", "*/*", "application/json"},
+		{"/bird", "application/json", "application/json"},
+		{"/bird", "application/xml", "application/xml"},
+		{"/bird", "application/json;q=0.5, application/xml", "application/xml"},
+		{"/bird", "application/json, application/xml", "application/json"},
+		{"/bird/1", "application/json", "application/json"},
+		{"/bird/1", "text/xml", "application/xml"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", tt.accept)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if status := recorder.Code; status != http.StatusOK {
+			t.Fatalf("%s with Accept %q: handler returned wrong status code: got %v want %v",
+				tt.path, tt.accept, status, http.StatusOK)
+		}
+		contentType := recorder.Header().Get("Content-Type")
+		if !strings.HasPrefix(contentType, tt.expectedContentType) {
+			t.Errorf("%s with Accept %q: got Content-Type %q want %q", tt.path, tt.accept, contentType, tt.expectedContentType)
+		}
+
+		// The body is in the format announced by the Content-Type
+		var bird Bird
+		switch {
+		case tt.expectedContentType == "application/json" && tt.path == "/bird":
+			var birds []Bird
+			err = json.Unmarshal(recorder.Body.Bytes(), &birds)
+			if len(birds) == 1 {
+				bird = birds[0]
+			}
+		case tt.expectedContentType == "application/json":
+			err = json.Unmarshal(recorder.Body.Bytes(), &bird)
+		case tt.path == "/bird":
+			var birds xmlBirds
+			err = xml.Unmarshal(recorder.Body.Bytes(), &birds)
+			if len(birds.Birds) == 1 {
+				bird = *birds.Birds[0]
+			}
+		default:
+			err = xml.Unmarshal(recorder.Body.Bytes(), &bird)
+		}
+		if err != nil {
+			t.Errorf("%s with Accept %q: the body can't be decoded: %v\n%s", tt.path, tt.accept, err, recorder.Body.String())
+		}
+		if bird.ID != 1 || bird.Species != "sparrow" {
+			t.Errorf("%s with Accept %q: unexpected bird %+v", tt.path, tt.accept, bird)
+		}
+	}
+}